@@ -0,0 +1,221 @@
+package sdk
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// AuthorizationCodeTokenSource gets an ID token with the OAuth 2.0 authorization
+// code grant using PKCE (RFC 7636). The user logs in with a browser and the
+// authorization code is received on a loopback redirect listener.
+//
+// The token is cached and refreshed with the refresh token when it expires. The
+// user is only asked to log in again if no valid token or refresh token is available.
+type AuthorizationCodeTokenSource struct {
+	// ClientID of the public OAuth client.
+	ClientID string
+
+	// AuthorizationURL is the authorization endpoint of the IdP.
+	AuthorizationURL string
+
+	// TokenURL is the token endpoint of the IdP.
+	TokenURL string
+
+	// Scope requested for the token, i.e. openid, profile and offline_access.
+	Scope []string
+
+	// RedirectPort is the port of the loopback redirect listener on 127.0.0.1.
+	// A random free port is used if zero, the IdP must then allow any port for
+	// loopback redirect URIs.
+	RedirectPort int
+
+	// RedirectPath is the path of the redirect URI, defaults to /oauth/callback.
+	RedirectPath string
+
+	// Client used for requests to the IdP, http.DefaultClient is used if nil.
+	Client *http.Client
+
+	// Store is used to persist the token between runs. Optional.
+	Store TokenStore
+
+	// OpenBrowser is called with the authorization URL the user needs to visit.
+	// By default the URL is printed to stderr.
+	OpenBrowser func(authURL string) error
+
+	// Timeout for the user to complete the login, defaults to 5 minutes.
+	Timeout time.Duration
+
+	session interactiveSession
+}
+
+// Token returns an ID token, asking the user to log in if required.
+func (ts *AuthorizationCodeTokenSource) Token() (string, error) {
+	token, err := ts.ExpiringToken()
+	if err != nil {
+		return "", err
+	}
+
+	return token.IDToken, nil
+}
+
+// ExpiringToken returns an ID token and its expiry, asking the user to log in if required.
+func (ts *AuthorizationCodeTokenSource) ExpiringToken() (*Token, error) {
+	return ts.session.getToken(ts.Store,
+		func(rt string) (*Token, error) {
+			return refreshToken(context.Background(), ts.Client, ts.TokenURL, ts.ClientID, rt)
+		},
+		func() (*Token, error) {
+			return ts.Login(context.Background())
+		},
+	)
+}
+
+// Login runs the authorization code flow and returns the token once the user has
+// completed the login. The token is not cached or persisted in the store.
+func (ts *AuthorizationCodeTokenSource) Login(ctx context.Context) (*Token, error) {
+	timeout := ts.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	verifier, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", ts.RedirectPort))
+	if err != nil {
+		return nil, fmt.Errorf("unable to start redirect listener: %w", err)
+	}
+	defer listener.Close()
+
+	redirectPath := ts.RedirectPath
+	if len(redirectPath) == 0 {
+		redirectPath = "/oauth/callback"
+	}
+	redirectURI := fmt.Sprintf("http://%s%s", listener.Addr().String(), redirectPath)
+
+	authURL, err := url.Parse(ts.AuthorizationURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorization URL: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+
+	q := authURL.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", ts.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("state", state)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	if len(ts.Scope) > 0 {
+		q.Set("scope", strings.Join(ts.Scope, " "))
+	}
+	authURL.RawQuery = q.Encode()
+
+	type callbackResult struct {
+		code string
+		err  error
+	}
+	results := make(chan callbackResult, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(redirectPath, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		// Requests without the state of this login, i.e. a browser prefetch or
+		// another local process, are rejected without ending the login.
+		if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+			http.Error(w, "Login failed: invalid state in authorization response", http.StatusBadRequest)
+			return
+		}
+
+		var result callbackResult
+		switch {
+		case len(query.Get("error")) > 0:
+			result.err = &OAuthError{Err: query.Get("error"), Description: query.Get("error_description")}
+		case len(query.Get("code")) == 0:
+			result.err = fmt.Errorf("no authorization code in authorization response")
+		default:
+			result.code = query.Get("code")
+		}
+
+		if result.err != nil {
+			http.Error(w, fmt.Sprintf("Login failed: %s", result.err), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Login successful, you can close this window.")
+		}
+
+		select {
+		case results <- result:
+		default:
+		}
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	defer server.Close()
+
+	openBrowser := ts.OpenBrowser
+	if openBrowser == nil {
+		openBrowser = printAuthorizationURL
+	}
+	if err := openBrowser(authURL.String()); err != nil {
+		return nil, err
+	}
+
+	var result callbackResult
+	select {
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("timed out waiting for the login to complete")
+		}
+		return nil, ctx.Err()
+	case result = <-results:
+	}
+
+	if result.err != nil {
+		return nil, result.err
+	}
+
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", result.code)
+	v.Set("redirect_uri", redirectURI)
+	v.Set("client_id", ts.ClientID)
+	v.Set("code_verifier", verifier)
+
+	return requestToken(ctx, ts.Client, ts.TokenURL, v)
+}
+
+// randomString returns a URL safe random string generated from n random bytes.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func printAuthorizationURL(authURL string) error {
+	fmt.Fprintf(os.Stderr, "To log in, open the following URL in a browser:\n\n  %s\n\n", authURL)
+	return nil
+}
@@ -0,0 +1,341 @@
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPollInterval = 2 * time.Second
+
+	// maxReconnectAttempts is the number of consecutive attempts to reconnect
+	// to the build log stream without receiving new results before giving up.
+	maxReconnectAttempts = 5
+)
+
+// ErrBuildNotFound is returned when the builder API does not know the build ID.
+var ErrBuildNotFound = errors.New("build not found")
+
+// BuildAsync submits the tar archive containing the build config and context to the function
+// builder API and returns as soon as the builder accepted the build. The result contains the
+// build ID and the in_progress status. The build keeps running if the connection to the
+// builder drops, use GetBuildStatus, WaitForBuild or StreamBuildLogs with the build ID to
+// follow it.
+//
+// Builders without support for asynchronous builds wait for the build to complete, in that
+// case the final result is returned and the ID may be empty.
+func (b *FunctionBuilder) BuildAsync(tarPath string) (BuildResult, error) {
+	return b.BuildAsyncContext(context.Background(), tarPath)
+}
+
+// BuildAsyncContext is like BuildAsync but the request is cancelled when ctx is done.
+// Cancelling ctx after the builder accepted the build does not cancel the build.
+func (b *FunctionBuilder) BuildAsyncContext(ctx context.Context, tarPath string) (BuildResult, error) {
+	return b.BuildWithSecretsAsyncContext(ctx, tarPath, nil)
+}
+
+// BuildWithSecretsAsync is like BuildAsync but seals the per-build BuildKit
+// secrets and appends them to the tar before sending.
+func (b *FunctionBuilder) BuildWithSecretsAsync(tarPath string, buildSecrets map[string]string) (BuildResult, error) {
+	return b.BuildWithSecretsAsyncContext(context.Background(), tarPath, buildSecrets)
+}
+
+// BuildWithSecretsAsyncContext is like BuildWithSecretsAsync but the request is
+// cancelled when ctx is done.
+func (b *FunctionBuilder) BuildWithSecretsAsyncContext(ctx context.Context, tarPath string, buildSecrets map[string]string) (BuildResult, error) {
+	res, err := b.build(ctx, tarPath, buildModeAsync, buildSecrets)
+	if err != nil {
+		return BuildResult{}, err
+	}
+
+	result, err := parseBuildResult(res)
+	if err != nil {
+		return BuildResult{}, err
+	}
+
+	if res.StatusCode == http.StatusAccepted && len(result.ID) == 0 {
+		return BuildResult{}, fmt.Errorf("builder accepted the build but did not return a build ID")
+	}
+
+	return result, nil
+}
+
+// GetBuildStatus returns the current result of the build with the given ID. The
+// result contains the status of the build, and the image once the build succeeded.
+// ErrBuildNotFound is returned if the builder does not know the build.
+func (b *FunctionBuilder) GetBuildStatus(ctx context.Context, buildID string) (BuildResult, error) {
+	res, err := b.doBuildRequest(ctx, buildID, "", "application/json")
+	if err != nil {
+		return BuildResult{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return BuildResult{}, newBuildStatusError(buildID, res)
+	}
+
+	result := BuildResult{}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return BuildResult{}, fmt.Errorf("unable to decode build status: %w", err)
+	}
+
+	return result, nil
+}
+
+// WaitForBuild polls the status of the build with the given ID until it completes
+// and returns the final result. Failed requests and server errors are retried until
+// ctx is done, so a build can be followed across network interruptions. The interval
+// between requests can be configured with WithPollInterval.
+func (b *FunctionBuilder) WaitForBuild(ctx context.Context, buildID string) (BuildResult, error) {
+	for {
+		result, err := b.GetBuildStatus(ctx, buildID)
+		if err == nil && result.Status != BuildInProgress {
+			return result, nil
+		}
+		if err != nil && !isRetryableBuildError(err) {
+			return BuildResult{}, err
+		}
+
+		if err := sleepContext(ctx, b.interval()); err != nil {
+			return BuildResult{}, fmt.Errorf("waiting for build %s: %w", buildID, err)
+		}
+	}
+}
+
+// StreamBuildLogs returns a stream of the results of the build with the given ID, starting
+// with the first log line. If the connection drops before the build completes the stream
+// reconnects and resumes after the last result that was received. The stream ends after
+// the final result of the build.
+func (b *FunctionBuilder) StreamBuildLogs(ctx context.Context, buildID string) (*BuildResultStream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	r := &reconnectReader{
+		ctx:      ctx,
+		cancel:   cancel,
+		interval: b.interval(),
+		open: func(ctx context.Context, offset int) (io.ReadCloser, error) {
+			query := ""
+			if offset > 0 {
+				query = "offset=" + strconv.Itoa(offset)
+			}
+
+			res, err := b.doBuildRequest(ctx, buildID, query, "application/x-ndjson")
+			if err != nil {
+				return nil, err
+			}
+			if res.StatusCode != http.StatusOK {
+				defer res.Body.Close()
+				return nil, newBuildStatusError(buildID, res)
+			}
+			return res.Body, nil
+		},
+	}
+
+	// Connect before returning so unknown builds and
+	// authentication errors are reported immediately.
+	if err := r.connect(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &BuildResultStream{r: r, ctx: ctx, cancel: cancel}, nil
+}
+
+// doBuildRequest sends a GET request for the build with the given ID. Log requests, with
+// an ndjson accept header, are sent to the logs path of the build. The request is signed
+// with the HMAC of the build ID as there is no request body.
+func (b *FunctionBuilder) doBuildRequest(ctx context.Context, buildID, query, accept string) (*http.Response, error) {
+	u := b.URL.JoinPath("/build", buildID)
+	if accept == "application/x-ndjson" {
+		u = u.JoinPath("logs")
+	}
+	u.RawQuery = query
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, []byte(b.hmacSecret))
+	mac.Write([]byte(buildID))
+
+	req.Header.Set("X-Build-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", "openfaas-go-sdk")
+
+	return b.client.Do(req)
+}
+
+func (b *FunctionBuilder) interval() time.Duration {
+	if b.pollInterval <= 0 {
+		return defaultPollInterval
+	}
+	return b.pollInterval
+}
+
+// buildStatusError is returned for an unexpected status code of a build status request.
+type buildStatusError struct {
+	buildID    string
+	statusCode int
+}
+
+func (e *buildStatusError) Error() string {
+	return fmt.Sprintf("unable to get build %s, builder responded with status code %d", e.buildID, e.statusCode)
+}
+
+func (e *buildStatusError) Unwrap() error {
+	if e.statusCode == http.StatusNotFound {
+		return ErrBuildNotFound
+	}
+	return nil
+}
+
+func newBuildStatusError(buildID string, res *http.Response) error {
+	return &buildStatusError{buildID: buildID, statusCode: res.StatusCode}
+}
+
+// isRetryableBuildError reports whether a failed build status request can be retried,
+// which is the case for network errors and server errors but not for client errors
+// such as an unknown build ID or invalid signature.
+func isRetryableBuildError(err error) bool {
+	var statusErr *buildStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode >= http.StatusInternalServerError || statusErr.statusCode == http.StatusTooManyRequests
+	}
+
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// reconnectReader reads the newline delimited build results of a build log stream. Only
+// complete lines are returned, so when the connection drops the stream is opened again at
+// the offset of the next result without returning partial results. The reader returns
+// io.EOF after the final result of the build.
+type reconnectReader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// open opens the log stream at the offset of the next result.
+	open     func(ctx context.Context, offset int) (io.ReadCloser, error)
+	interval time.Duration
+
+	body io.ReadCloser
+	br   *bufio.Reader
+
+	// offset is the number of results that were read.
+	offset  int
+	pending []byte
+	done    bool
+}
+
+func (r *reconnectReader) Read(p []byte) (int, error) {
+	attempts := 0
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		if r.br == nil {
+			if err := r.connect(); err != nil {
+				if !isRetryableBuildError(err) || attempts >= maxReconnectAttempts {
+					return 0, err
+				}
+				attempts++
+				if err := sleepContext(r.ctx, r.interval); err != nil {
+					return 0, err
+				}
+				continue
+			}
+		}
+
+		line, err := r.br.ReadBytes('\n')
+		if err != nil && !(err == io.EOF && json.Valid(line)) {
+			// The connection dropped or ended without the final result,
+			// discard any partial line and resume at the current offset.
+			r.disconnect()
+			if r.ctx.Err() != nil {
+				return 0, r.ctx.Err()
+			}
+			if attempts >= maxReconnectAttempts {
+				return 0, fmt.Errorf("build log stream ended before the build completed: %w", err)
+			}
+			attempts++
+			if err := sleepContext(r.ctx, r.interval); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		if line[len(line)-1] != '\n' {
+			line = append(line, '\n')
+		}
+		r.pending = line
+		r.offset++
+
+		var result struct {
+			Status string `json:"status"`
+		}
+		if json.Unmarshal(line, &result) == nil && (result.Status == BuildSuccess || result.Status == BuildFailed) {
+			r.done = true
+			r.disconnect()
+		}
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *reconnectReader) connect() error {
+	body, err := r.open(r.ctx, r.offset)
+	if err != nil {
+		return err
+	}
+
+	r.body = body
+	r.br = bufio.NewReader(body)
+	return nil
+}
+
+func (r *reconnectReader) disconnect() {
+	if r.body != nil {
+		r.body.Close()
+	}
+	r.body = nil
+	r.br = nil
+}
+
+// Close closes the log stream and stops reconnect attempts.
+func (r *reconnectReader) Close() error {
+	r.done = true
+	r.cancel()
+	r.disconnect()
+	return nil
+}
@@ -0,0 +1,210 @@
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_BuildAsync(t *testing.T) {
+	logs, err := os.ReadFile("../testdata/buildlogs.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(bytes.TrimSpace(logs), []byte("\n"))
+
+	var (
+		lock          sync.Mutex
+		statusCalls   int
+		logOffsets    []string
+		prefer        string
+		dropAfterLine = 10
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /build", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		prefer = r.Header.Get("Prefer")
+		lock.Unlock()
+
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"id":"b1","status":"in_progress"}`))
+	})
+	mux.HandleFunc("GET /build/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "b1" {
+			http.NotFound(w, r)
+			return
+		}
+
+		lock.Lock()
+		statusCalls++
+		calls := statusCalls
+		lock.Unlock()
+
+		switch calls {
+		case 1:
+			w.Write([]byte(`{"id":"b1","status":"in_progress"}`))
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"id":"b1","image":"ttl.sh/openfaas/test-image-hello:10m","status":"success"}`))
+		}
+	})
+	mux.HandleFunc("GET /build/{id}/logs", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "b1" {
+			http.NotFound(w, r)
+			return
+		}
+
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+		lock.Lock()
+		logOffsets = append(logOffsets, r.URL.Query().Get("offset"))
+		lock.Unlock()
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for i := offset; i < len(lines); i++ {
+			if offset == 0 && i == dropAfterLine {
+				// Drop the connection in the middle of a line.
+				w.Write(lines[i][:5])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+			w.Write(lines[i])
+			w.(http.Flusher).Flush()
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	b := NewFunctionBuilder(u, http.DefaultClient, WithPollInterval(time.Millisecond))
+
+	tarPath := filepath.Join(t.TempDir(), "req.tar")
+	if err := os.WriteFile(tarPath, []byte("tar"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := b.BuildAsync(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(BuildResult{ID: "b1", Status: BuildInProgress}, result); diff != "" {
+		t.Fatalf("async result mismatch (-want +got):\n%s", diff)
+	}
+	if prefer != "respond-async" {
+		t.Fatalf("want Prefer: respond-async header, got %q", prefer)
+	}
+
+	t.Run("wait for build", func(t *testing.T) {
+		result, err := b.WaitForBuild(t.Context(), "b1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := BuildResult{ID: "b1", Image: "ttl.sh/openfaas/test-image-hello:10m", Status: BuildSuccess}
+		if diff := cmp.Diff(want, result); diff != "" {
+			t.Fatalf("build result mismatch (-want +got):\n%s", diff)
+		}
+		if statusCalls != 3 {
+			t.Fatalf("want 3 status requests, got %d", statusCalls)
+		}
+	})
+
+	t.Run("stream logs reconnects after connection drop", func(t *testing.T) {
+		stream, err := b.StreamBuildLogs(t.Context(), "b1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var results []BuildResult
+		for result, err := range stream.Results() {
+			if err != nil {
+				t.Fatalf("unexpected error from stream: %v", err)
+			}
+			results = append(results, result)
+		}
+
+		if len(results) != len(lines) {
+			t.Fatalf("want %d results, got %d", len(lines), len(results))
+		}
+		if results[len(results)-1].Status != BuildSuccess {
+			t.Fatalf("want final result with status success, got %q", results[len(results)-1].Status)
+		}
+		if diff := cmp.Diff([]string{"", strconv.Itoa(dropAfterLine)}, logOffsets); diff != "" {
+			t.Fatalf("log stream offsets mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("unknown build", func(t *testing.T) {
+		if _, err := b.WaitForBuild(t.Context(), "unknown"); !errors.Is(err, ErrBuildNotFound) {
+			t.Fatalf("want ErrBuildNotFound, got: %v", err)
+		}
+		if _, err := b.StreamBuildLogs(t.Context(), "unknown"); !errors.Is(err, ErrBuildNotFound) {
+			t.Fatalf("want ErrBuildNotFound, got: %v", err)
+		}
+	})
+}
+
+func Test_BuildAsyncContext_Cancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	u, _ := url.Parse(server.URL)
+	b := NewFunctionBuilder(u, http.DefaultClient)
+
+	tarPath := filepath.Join(t.TempDir(), "req.tar")
+	if err := os.WriteFile(tarPath, []byte("tar"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := b.BuildAsyncContext(ctx, tarPath); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want context.DeadlineExceeded, got: %v", err)
+	}
+}
+
+func Test_reconnectReader_GivesUp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The stream always ends before the final result.
+		if len(r.URL.Query().Get("offset")) == 0 {
+			w.Write([]byte(`{"log":["step 1"],"status":"in_progress"}` + "\n"))
+		}
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	b := NewFunctionBuilder(u, http.DefaultClient, WithPollInterval(time.Millisecond))
+
+	stream, err := b.StreamBuildLogs(t.Context(), "b1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream.r)
+	for scanner.Scan() {
+	}
+	if scanner.Err() == nil {
+		t.Fatal("want error when the stream keeps ending before the build completes")
+	}
+}
@@ -0,0 +1,138 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/openfaas/go-sdk/stack"
+)
+
+// AdditionalPackageBuildArg is the build arg used by the language templates
+// to install the native packages of the build options of a function.
+const AdditionalPackageBuildArg = "ADDITIONAL_PACKAGE"
+
+var (
+	// imageReferenceRegexp matches an image reference with an optional
+	// registry, tag and digest, i.e. registry:5000/org/fn:1.0@sha256:...
+	imageReferenceRegexp = regexp.MustCompile(`^(?:[a-zA-Z0-9.-]+(?::[0-9]+)?/)?` +
+		`[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*` +
+		`(?::[A-Za-z0-9_][A-Za-z0-9_.-]{0,127})?` +
+		`(?:@[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,})?$`)
+
+	platformRegexp = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(?:/[a-z0-9]+)?$`)
+
+	targetRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.-]*$`)
+)
+
+// Validate checks the build config before the build tar is created, so mistakes such as
+// an invalid image reference are reported without waiting for the builder. All problems
+// that are found are returned in a single error.
+func (c *BuildConfig) Validate() error {
+	if c == nil {
+		return fmt.Errorf("invalid build config: build config is required")
+	}
+
+	var errs []error
+
+	if len(c.Image) == 0 {
+		errs = append(errs, fmt.Errorf("image is required"))
+	} else if !imageReferenceRegexp.MatchString(c.Image) {
+		errs = append(errs, fmt.Errorf("invalid image reference: %q", c.Image))
+	}
+
+	for _, tag := range c.Tags {
+		if !imageReferenceRegexp.MatchString(tag) {
+			errs = append(errs, fmt.Errorf("invalid tag: %q", tag))
+		}
+	}
+
+	for _, platform := range c.Platforms {
+		if !platformRegexp.MatchString(platform) {
+			errs = append(errs, fmt.Errorf("invalid platform: %q, use the format os/arch[/variant]", platform))
+		}
+	}
+
+	if len(c.Target) > 0 && !targetRegexp.MatchString(c.Target) {
+		errs = append(errs, fmt.Errorf("invalid target stage: %q", c.Target))
+	}
+
+	for name := range c.BuildArgs {
+		if len(name) == 0 || strings.ContainsAny(name, "= \t\n") {
+			errs = append(errs, fmt.Errorf("invalid build arg name: %q", name))
+		}
+	}
+
+	for name := range c.Labels {
+		if len(strings.TrimSpace(name)) == 0 {
+			errs = append(errs, fmt.Errorf("label name is required"))
+		}
+	}
+
+	for _, ref := range c.CacheFrom {
+		if len(strings.TrimSpace(ref)) == 0 {
+			errs = append(errs, fmt.Errorf("cache-from source is required"))
+		}
+	}
+
+	for _, ref := range c.CacheTo {
+		if len(strings.TrimSpace(ref)) == 0 {
+			errs = append(errs, fmt.Errorf("cache-to destination is required"))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid build config: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// ApplyBuildOptions resolves the named build options of a function, i.e. "dev" or "dbg",
+// to the native packages defined by the language template and adds them to the
+// ADDITIONAL_PACKAGE build arg. Packages that are already set in the build arg are kept
+// and duplicates are removed. An error is returned for build options that are not
+// defined by the template.
+func (c *BuildConfig) ApplyBuildOptions(template *stack.LanguageTemplate, options []string) error {
+	if len(options) == 0 {
+		return nil
+	}
+
+	if template == nil {
+		return fmt.Errorf("build options %s require a language template", strings.Join(options, ", "))
+	}
+
+	var packages []string
+	for _, name := range options {
+		found := false
+		for _, option := range template.BuildOptions {
+			if option.Name == name {
+				packages = append(packages, option.Packages...)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("build option %q is not defined by template %s", name, template.Language)
+		}
+	}
+
+	if c.BuildArgs == nil {
+		c.BuildArgs = map[string]string{}
+	}
+	packages = append(packages, strings.Fields(c.BuildArgs[AdditionalPackageBuildArg])...)
+
+	seen := make(map[string]bool, len(packages))
+	unique := make([]string, 0, len(packages))
+	for _, p := range packages {
+		if !seen[p] {
+			seen[p] = true
+			unique = append(unique, p)
+		}
+	}
+
+	c.BuildArgs[AdditionalPackageBuildArg] = strings.Join(unique, " ")
+	return nil
+}
@@ -0,0 +1,146 @@
+package builder
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/openfaas/go-sdk/stack"
+)
+
+func Test_BuildConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *BuildConfig
+		wantErr []string
+	}{
+		{
+			name: "valid config",
+			config: &BuildConfig{
+				Image:     "registry.example.com:5000/openfaas/env:0.1.0",
+				Platforms: []string{"linux/amd64", "linux/arm/v7"},
+				Target:    "runtime",
+				Tags:      []string{"registry.example.com:5000/openfaas/env:latest"},
+				BuildArgs: map[string]string{"GO111MODULE": "on"},
+				Labels:    map[string]string{"org.opencontainers.image.source": "https://github.com/openfaas/go-sdk"},
+				CacheFrom: []string{"type=registry,ref=registry.example.com:5000/openfaas/env:cache"},
+				CacheTo:   []string{"type=registry,ref=registry.example.com:5000/openfaas/env:cache,mode=max"},
+			},
+		},
+		{
+			name:    "nil config",
+			wantErr: []string{"build config is required"},
+		},
+		{
+			name:    "missing image",
+			config:  &BuildConfig{},
+			wantErr: []string{"image is required"},
+		},
+		{
+			name: "all problems are reported",
+			config: &BuildConfig{
+				Image:     "ttl.sh/OpenFaaS/env",
+				Platforms: []string{"amd64"},
+				Target:    "-runtime",
+				Tags:      []string{"env:latest tag"},
+				BuildArgs: map[string]string{"A=B": ""},
+				CacheTo:   []string{""},
+			},
+			wantErr: []string{
+				`invalid image reference: "ttl.sh/OpenFaaS/env"`,
+				`invalid platform: "amd64"`,
+				`invalid target stage: "-runtime"`,
+				`invalid tag: "env:latest tag"`,
+				`invalid build arg name: "A=B"`,
+				"cache-to destination is required",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			if len(test.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("want no error, got: %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("want validation error")
+			}
+			for _, want := range test.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("want error to contain %q, got: %v", want, err)
+				}
+			}
+		})
+	}
+
+	t.Run("invalid config fails before the tar is created", func(t *testing.T) {
+		tarPath := filepath.Join(t.TempDir(), "build.tar")
+		if err := MakeTar(tarPath, t.TempDir(), &BuildConfig{Image: "Invalid Image"}); err == nil {
+			t.Fatal("want validation error")
+		}
+		if _, err := os.Stat(tarPath); !os.IsNotExist(err) {
+			t.Fatalf("want no tar archive to be created, got: %v", err)
+		}
+	})
+}
+
+func Test_BuildConfig_JSON(t *testing.T) {
+	config := BuildConfig{
+		Image:     "ttl.sh/openfaas/env:latest",
+		Target:    "runtime",
+		Labels:    map[string]string{"team": "functions"},
+		CacheFrom: []string{"ttl.sh/openfaas/env:cache"},
+		CacheTo:   []string{"type=inline"},
+		Tags:      []string{"ttl.sh/openfaas/env:0.1.0"},
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"image":"ttl.sh/openfaas/env:latest","target":"runtime","labels":{"team":"functions"},` +
+		`"cacheFrom":["ttl.sh/openfaas/env:cache"],"cacheTo":["type=inline"],"tags":["ttl.sh/openfaas/env:0.1.0"]}`
+	if string(data) != want {
+		t.Fatalf("want %s, got %s", want, string(data))
+	}
+}
+
+func Test_BuildConfig_ApplyBuildOptions(t *testing.T) {
+	template := &stack.LanguageTemplate{
+		Language: "python3",
+		BuildOptions: []stack.BuildOption{
+			{Name: "dev", Packages: []string{"make", "gcc"}},
+			{Name: "dbg", Packages: []string{"gdb", "make"}},
+		},
+	}
+
+	config := &BuildConfig{
+		Image:     "env",
+		BuildArgs: map[string]string{AdditionalPackageBuildArg: "curl gcc"},
+	}
+	if err := config.ApplyBuildOptions(template, []string{"dev", "dbg"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{AdditionalPackageBuildArg: "make gcc gdb curl"}
+	if diff := cmp.Diff(want, config.BuildArgs); diff != "" {
+		t.Fatalf("build args mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := config.ApplyBuildOptions(template, []string{"unknown"}); err == nil || !strings.Contains(err.Error(), `build option "unknown" is not defined`) {
+		t.Fatalf("want error for unknown build option, got: %v", err)
+	}
+
+	if err := config.ApplyBuildOptions(nil, []string{"dev"}); err == nil {
+		t.Fatal("want error for build options without a language template")
+	}
+}
@@ -4,20 +4,24 @@ import (
 	"archive/tar"
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"iter"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
-	hmac "github.com/alexellis/hmac/v2"
 	"github.com/openfaas/go-sdk/internal/httpclient"
 )
 
@@ -42,10 +46,30 @@ type BuildConfig struct {
 
 	// SkipPush is a flag to skip skip pushing the image to the registry.
 	SkipPush bool `json:"skipPush,omitempty"`
+
+	// Target is the Dockerfile stage to build.
+	Target string `json:"target,omitempty"`
+
+	// Labels are added to the image.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// CacheFrom are external cache sources, i.e. an image
+	// reference or "type=registry,ref=registry/fn:cache".
+	CacheFrom []string `json:"cacheFrom,omitempty"`
+
+	// CacheTo are cache export destinations,
+	// i.e. "type=registry,ref=registry/fn:cache,mode=max".
+	CacheTo []string `json:"cacheTo,omitempty"`
+
+	// Tags are additional image references the image is pushed to.
+	Tags []string `json:"tags,omitempty"`
 }
 
 // BuildResult represents the result of a build operation.
 type BuildResult struct {
+	// ID of the build, set for builds submitted with BuildAsync.
+	ID string `json:"id,omitempty"`
+
 	// Log contains the build log.
 	Log []string `json:"log"`
 
@@ -57,6 +81,18 @@ type BuildResult struct {
 
 	// Error is the error message if the build failed.
 	Error string `json:"error,omitempty"`
+
+	// Digest is the digest of the pushed image manifest, or the manifest
+	// list of a multi-arch build, if reported by the builder.
+	Digest string `json:"digest,omitempty"`
+
+	// PlatformDigests are the manifest digests by platform of a
+	// multi-arch build, if reported by the builder.
+	PlatformDigests map[string]string `json:"platformDigests,omitempty"`
+
+	// Duration is the time in seconds since the build started, reported by
+	// the builder with each result. Use Elapsed to get it as a time.Duration.
+	Duration float64 `json:"duration,omitempty"`
 }
 
 type FunctionBuilder struct {
@@ -71,6 +107,13 @@ type FunctionBuilder struct {
 
 	sealConfig      sealConfig
 	buildSecretsErr error
+
+	// TLS settings applied to the http client.
+	tlsConfig *httpclient.TLSConfig
+
+	// Interval between status requests and log stream
+	// reconnects for asynchronous builds.
+	pollInterval time.Duration
 }
 
 type BuilderOption func(*FunctionBuilder)
@@ -82,145 +125,364 @@ func WithHmacAuth(secret string) BuilderOption {
 	}
 }
 
+// WithCABundle configures a PEM encoded CA bundle that is trusted in addition
+// to the system roots for requests to the builder API.
+func WithCABundle(path string) BuilderOption {
+	return func(b *FunctionBuilder) {
+		b.tls().CAFile = path
+	}
+}
+
+// WithClientCertificate configures a client certificate and key for mutual TLS.
+// The files are loaded again when they change so rotated certificates are picked up.
+func WithClientCertificate(certFile, keyFile string) BuilderOption {
+	return func(b *FunctionBuilder) {
+		b.tls().CertFile = certFile
+		b.tls().KeyFile = keyFile
+	}
+}
+
+// WithServerName overrides the server name used to verify the certificate of the builder API.
+func WithServerName(name string) BuilderOption {
+	return func(b *FunctionBuilder) {
+		b.tls().ServerName = name
+	}
+}
+
+// WithInsecureSkipVerify disables verification of the server certificate.
+// It should only be used for development.
+func WithInsecureSkipVerify() BuilderOption {
+	return func(b *FunctionBuilder) {
+		b.tls().InsecureSkipVerify = true
+	}
+}
+
+// WithPollInterval configures the interval between build status requests in WaitForBuild
+// and between reconnect attempts in StreamBuildLogs. The default interval is 2 seconds.
+func WithPollInterval(interval time.Duration) BuilderOption {
+	return func(b *FunctionBuilder) {
+		b.pollInterval = interval
+	}
+}
+
+func (b *FunctionBuilder) tls() *httpclient.TLSConfig {
+	if b.tlsConfig == nil {
+		b.tlsConfig = &httpclient.TLSConfig{}
+	}
+	return b.tlsConfig
+}
+
 // NewFunctionBuilder create a new builder for building OpenFaaS functions using the Function Builder API.
 func NewFunctionBuilder(url *url.URL, client *http.Client, options ...BuilderOption) *FunctionBuilder {
-	client = httpclient.WithFaasTransport(client)
-
 	b := &FunctionBuilder{
-		URL: url,
-
-		client: client,
+		URL:          url,
+		pollInterval: defaultPollInterval,
 	}
 
 	for _, option := range options {
 		option(b)
 	}
 
+	if b.tlsConfig != nil {
+		client = httpclient.WithTLSConfig(client, b.tlsConfig)
+	}
+
+	b.client = httpclient.WithFaasTransport(client)
+
 	return b
 }
 
-func (b *FunctionBuilder) build(tarPath string, stream bool, buildSecrets map[string]string) (*http.Response, error) {
-	tarFileBytes, err := os.ReadFile(tarPath)
+// buildMode selects how the builder API responds to a build request.
+type buildMode int
+
+const (
+	// buildModeResult waits for the build and returns the result.
+	buildModeResult buildMode = iota
+	// buildModeStream streams build results as newline delimited JSON.
+	buildModeStream
+	// buildModeAsync returns a build ID as soon as the build is accepted.
+	buildModeAsync
+)
+
+func (b *FunctionBuilder) build(ctx context.Context, tarPath string, mode buildMode, buildSecrets map[string]string) (*http.Response, error) {
+	if b.buildSecretsErr != nil {
+		return nil, b.buildSecretsErr
+	}
+
+	sealedSecrets, err := b.sealSecrets(buildSecrets)
 	if err != nil {
 		return nil, err
 	}
 
-	if b.buildSecretsErr != nil {
-		return nil, b.buildSecretsErr
+	size, err := buildTarSize(tarPath, sealedSecrets != nil)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(buildSecrets) > 0 {
-		if len(b.sealConfig.PublicKey) == 0 {
-			return nil, fmt.Errorf("build secrets provided but no build secrets key configured, use WithBuildSecretsKey")
+	// The file is opened for each write, so it stays open while the request
+	// body is streamed, even after the builder responded with the headers.
+	return b.send(ctx, func(w io.Writer) error {
+		tarFile, err := os.Open(tarPath)
+		if err != nil {
+			return err
 		}
+		defer tarFile.Close()
 
-		sealedData, err := sealBuildSecrets(b.sealConfig, buildSecrets)
-		if err != nil {
-			return nil, fmt.Errorf("sealing build secrets: %w", err)
+		if _, err := io.Copy(w, io.NewSectionReader(tarFile, 0, size)); err != nil {
+			return err
 		}
 
-		tarFileBytes, err = appendToTar(tarFileBytes, BuildSecretsFileName, sealedData)
+		if sealedSecrets != nil {
+			return writeTarEntry(w, BuildSecretsFileName, sealedSecrets)
+		}
+		return nil
+	}, mode)
+}
+
+// buildTarSize returns the number of bytes of the tar archive at tarPath to send. If
+// secrets are appended, the end of archive marker and any padding after it are
+// stripped so the archive can be continued.
+func buildTarSize(tarPath string, appendSecrets bool) (int64, error) {
+	tarFile, err := os.Open(tarPath)
+	if err != nil {
+		return 0, err
+	}
+	defer tarFile.Close()
+
+	if !appendSecrets {
+		info, err := tarFile.Stat()
 		if err != nil {
-			return nil, fmt.Errorf("adding sealed secrets to tar: %w", err)
+			return 0, err
 		}
+		return info.Size(), nil
+	}
+	return tarContentSize(tarFile)
+}
+
+// sealSecrets seals the build secrets with the builder's public key. It returns
+// nil if there are no build secrets.
+func (b *FunctionBuilder) sealSecrets(buildSecrets map[string]string) ([]byte, error) {
+	if len(buildSecrets) == 0 {
+		return nil, nil
+	}
+
+	if len(b.sealConfig.PublicKey) == 0 {
+		return nil, fmt.Errorf("build secrets provided but no build secrets key configured, use WithBuildSecretsKey")
+	}
+
+	sealedData, err := sealBuildSecrets(b.sealConfig, buildSecrets)
+	if err != nil {
+		return nil, fmt.Errorf("sealing build secrets: %w", err)
+	}
+
+	return sealedData, nil
+}
+
+// send streams the tar archive written by writeTar to the builder API.
+//
+// The archive is never held in memory. writeTar is called twice, first to compute
+// the HMAC signature that is sent in the X-Build-Signature header and the length of
+// the archive, and then to stream the archive in the request body through a pipe.
+// writeTar must be deterministic and write the same bytes each time it is called,
+// the request fails if the streamed archive does not match the signed one. The
+// request is cancelled when ctx is done.
+func (b *FunctionBuilder) send(ctx context.Context, writeTar func(w io.Writer) error, mode buildMode) (*http.Response, error) {
+	digest, size, err := b.signTar(writeTar)
+	if err != nil {
+		return nil, err
+	}
+
+	body := func() (io.ReadCloser, error) {
+		pr, pw := io.Pipe()
+		go func() {
+			streamed, n, err := b.signTar(func(w io.Writer) error {
+				return writeTar(io.MultiWriter(pw, w))
+			})
+			if err == nil && (n != size || !hmac.Equal(streamed, digest)) {
+				err = fmt.Errorf("build context changed while it was sent to the builder, the archive does not match its signature")
+			}
+			pw.CloseWithError(err)
+		}()
+		return pr, nil
 	}
 
 	u := b.URL.JoinPath("/build")
 
-	digest := hmac.Sign(tarFileBytes, []byte(b.hmacSecret), sha256.New)
-	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(tarFileBytes))
+	bodyReader, _ := body()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bodyReader)
 	if err != nil {
+		bodyReader.Close()
 		return nil, err
 	}
+	req.GetBody = body
+	req.ContentLength = size
 
 	req.Header.Set("X-Build-Signature", "sha256="+hex.EncodeToString(digest))
 	req.Header.Set("Content-Type", "application/octet-stream")
 	req.Header.Set("User-Agent", "openfaas-go-sdk")
 
-	if stream {
+	switch mode {
+	case buildModeStream:
 		req.Header.Set("Accept", "application/x-ndjson")
+	case buildModeAsync:
+		req.Header.Set("Prefer", "respond-async")
 	}
 
 	return b.client.Do(req)
 }
 
-// appendToTar appends a file entry to an existing tar archive.
-func appendToTar(tarBytes []byte, name string, data []byte) ([]byte, error) {
-	// A tar archive ends with two 512-byte zero blocks.
-	// Trim them so we can append before the end.
-	trimmed := tarBytes
-	for len(trimmed) >= 512 && isZeroBlock(trimmed[len(trimmed)-512:]) {
-		trimmed = trimmed[:len(trimmed)-512]
+// signTar returns the HMAC signature and the length of the archive written by writeTar.
+func (b *FunctionBuilder) signTar(writeTar func(w io.Writer) error) ([]byte, int64, error) {
+	mac := hmac.New(sha256.New, []byte(b.hmacSecret))
+	counter := &countingWriter{w: mac}
+	if err := writeTar(counter); err != nil {
+		return nil, 0, err
+	}
+
+	return mac.Sum(nil), counter.n, nil
+}
+
+// newLogLines returns the lines of log that are not in collected. A log that starts with
+// all collected lines is cumulative and only the lines after them are new, otherwise
+// all lines of log are new.
+func newLogLines(collected, log []string) []string {
+	if len(collected) > 0 && len(log) >= len(collected) && slices.Equal(log[:len(collected)], collected) {
+		return log[len(collected):]
 	}
 
-	var buf bytes.Buffer
-	buf.Write(trimmed)
+	return log
+}
 
-	tw := tar.NewWriter(&buf)
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// tarContentSize returns the size of the tar archive up to the end of its last entry,
+// without the zero blocks that mark the end of the archive and any padding after them.
+func tarContentSize(r io.Reader) (int64, error) {
+	counter := &countingReader{r: r}
+	tr := tar.NewReader(counter)
+
+	var size int64
+	for {
+		if _, err := tr.Next(); err == io.EOF {
+			return size, nil
+		} else if err != nil {
+			return 0, err
+		}
+
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return 0, err
+		}
+
+		// The data of an entry is padded to a multiple of the block size.
+		size = (counter.n + blockSize - 1) / blockSize * blockSize
+	}
+}
+
+// blockSize is the size of a tar header or data block.
+const blockSize = 512
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// writeTarEntry writes a tar archive with a single file entry to w.
+func writeTarEntry(w io.Writer, name string, data []byte) error {
+	tw := tar.NewWriter(w)
 	if err := tw.WriteHeader(&tar.Header{
 		Name: name,
 		Mode: 0600,
 		Size: int64(len(data)),
 	}); err != nil {
-		return nil, err
+		return err
 	}
 	if _, err := tw.Write(data); err != nil {
-		return nil, err
-	}
-	if err := tw.Close(); err != nil {
-		return nil, err
+		return err
 	}
 
-	return buf.Bytes(), nil
-}
-
-func isZeroBlock(b []byte) bool {
-	for _, v := range b {
-		if v != 0 {
-			return false
-		}
-	}
-	return true
+	return tw.Close()
 }
 
 // Build invokes the function builder API with the provided tar archive containing the build config and context
 // to build and push a function image.
 func (b *FunctionBuilder) Build(tarPath string) (BuildResult, error) {
-	res, err := b.build(tarPath, false, nil)
+	res, err := b.build(context.Background(), tarPath, buildModeResult, nil)
 	if err != nil {
 		return BuildResult{}, err
 	}
 
-	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted {
-		return BuildResult{}, fmt.Errorf("failed to build function, builder responded with status code %d", res.StatusCode)
-	}
-
-	result := BuildResult{}
-	if res.Body != nil {
-		defer res.Body.Close()
-
-		data, err := io.ReadAll(res.Body)
-		if err != nil {
-			return BuildResult{}, err
-		}
-		if err := json.Unmarshal(data, &result); err != nil {
-			return BuildResult{}, err
-		}
-	}
-
-	return result, nil
+	return parseBuildResult(res)
 }
 
 // BuildWithSecrets invokes the function builder API using the provided
 // tar archive plus sealed per-build BuildKit secrets.
 // The secrets are sealed and appended to the tar before sending.
 func (b *FunctionBuilder) BuildWithSecrets(tarPath string, buildSecrets map[string]string) (BuildResult, error) {
-	res, err := b.build(tarPath, false, buildSecrets)
+	res, err := b.build(context.Background(), tarPath, buildModeResult, buildSecrets)
 	if err != nil {
 		return BuildResult{}, err
 	}
 
+	return parseBuildResult(res)
+}
+
+// BuildWithStream invokes the function builder API with the provided tar archive containing the build config and context
+// to build and push a function image.
+//
+// The function returns a sequence of build results. The sequence is closed when the build is complete.
+func (b *FunctionBuilder) BuildWithStream(tarPath string) (*BuildResultStream, error) {
+	return b.BuildWithStreamContext(context.Background(), tarPath)
+}
+
+// BuildWithStreamContext is like BuildWithStream but the build request is cancelled
+// when ctx is done, which also ends the stream with the error of ctx.
+func (b *FunctionBuilder) BuildWithStreamContext(ctx context.Context, tarPath string) (*BuildResultStream, error) {
+	return b.BuildWithSecretsStreamContext(ctx, tarPath, nil)
+}
+
+// BuildWithSecretsStream invokes the function builder API using the provided
+// tar archive plus sealed per-build BuildKit secrets and requests streamed logs.
+func (b *FunctionBuilder) BuildWithSecretsStream(tarPath string, buildSecrets map[string]string) (*BuildResultStream, error) {
+	return b.BuildWithSecretsStreamContext(context.Background(), tarPath, buildSecrets)
+}
+
+// BuildWithSecretsStreamContext is like BuildWithSecretsStream but the build request is
+// cancelled when ctx is done, which also ends the stream with the error of ctx.
+func (b *FunctionBuilder) BuildWithSecretsStreamContext(ctx context.Context, tarPath string, buildSecrets map[string]string) (*BuildResultStream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	res, err := b.build(ctx, tarPath, buildModeStream, buildSecrets)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return newBuildResultStream(ctx, cancel, res)
+}
+
+// parseBuildResult reads the build result from the response of the builder API.
+func parseBuildResult(res *http.Response) (BuildResult, error) {
 	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted {
+		if res.Body != nil {
+			res.Body.Close()
+		}
 		return BuildResult{}, fmt.Errorf("failed to build function, builder responded with status code %d", res.StatusCode)
 	}
 
@@ -240,141 +502,302 @@ func (b *FunctionBuilder) BuildWithSecrets(tarPath string, buildSecrets map[stri
 	return result, nil
 }
 
-// BuildWithStream invokes the function builder API with the provided tar archive containing the build config and context
-// to build and push a function image.
-//
-// The function returns a sequence of build results. The sequence is closed when the build is complete.
-func (b *FunctionBuilder) BuildWithStream(tarPath string) (*BuildResultStream, error) {
-	res, err := b.build(tarPath, true, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted {
-		return nil, fmt.Errorf("failed to build function, builder responded with status code %d", res.StatusCode)
-	}
-
-	return &BuildResultStream{r: res.Body}, nil
-}
-
-// BuildWithSecretsStream invokes the function builder API using the provided
-// tar archive plus sealed per-build BuildKit secrets and requests streamed logs.
-func (b *FunctionBuilder) BuildWithSecretsStream(tarPath string, buildSecrets map[string]string) (*BuildResultStream, error) {
-	res, err := b.build(tarPath, true, buildSecrets)
-	if err != nil {
-		return nil, err
-	}
-
+// newBuildResultStream returns a stream of the build results in the response of the builder API.
+// cancel is called to cancel the request when the stream is closed.
+func newBuildResultStream(ctx context.Context, cancel context.CancelFunc, res *http.Response) (*BuildResultStream, error) {
 	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted {
+		res.Body.Close()
+		cancel()
 		return nil, fmt.Errorf("failed to build function, builder responded with status code %d", res.StatusCode)
 	}
 
-	return &BuildResultStream{r: res.Body}, nil
+	return &BuildResultStream{r: res.Body, ctx: ctx, cancel: cancel}, nil
 }
 
 // BuildResultStream represents a stream of build results.
 // The Results method can be used to iterate over the build results.
 type BuildResultStream struct {
 	r io.ReadCloser // The reader provided by the client.
+
+	// ctx and cancel are the context of the build request, if any.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // Results returns an iterator over build results.
 // It returns a single-use iterator
+//
+// Each line of the stream is decoded as a build result, there is no limit on the length
+// of a line. Iteration ends after the last result, or after the first error which is
+// yielded with an empty result. Errors are returned when the connection to the builder
+// fails, when a line can not be decoded or with the error of the context of the build
+// request when it is cancelled.
 func (b *BuildResultStream) Results() iter.Seq2[BuildResult, error] {
 	return func(yield func(BuildResult, error) bool) {
-		defer b.r.Close()
+		defer b.Close()
 
-		scanner := bufio.NewScanner(b.r)
+		br := bufio.NewReader(b.r)
+		for {
+			line, readErr := br.ReadBytes('\n')
+			if readErr != nil && readErr != io.EOF {
+				yield(BuildResult{}, b.streamError(readErr))
+				return
+			}
 
-		for scanner.Scan() {
-			line := scanner.Bytes()
-			var result BuildResult
-			if err := json.Unmarshal(line, &result); err != nil {
-				if ok := yield(BuildResult{}, err); !ok {
+			if len(bytes.TrimSpace(line)) > 0 {
+				var result BuildResult
+				if err := json.Unmarshal(line, &result); err != nil {
+					yield(BuildResult{}, fmt.Errorf("unable to decode build result: %w", err))
+					return
+				}
+				if !yield(result, nil) {
 					return
 				}
 			}
-			if ok := yield(result, nil); !ok {
+
+			if readErr == io.EOF {
 				return
 			}
+		}
+	}
+}
 
-			if err := scanner.Err(); err != nil {
-				if ok := yield(BuildResult{}, err); !ok {
-					return
-				}
-			}
+// streamError returns the error of the context of the build request if it was cancelled,
+// as the error returned by the response body does not tell why the request ended.
+func (b *BuildResultStream) streamError(err error) error {
+	if b.ctx != nil && b.ctx.Err() != nil {
+		return b.ctx.Err()
+	}
+	return err
+}
+
+// Collect reads all results of the stream and returns the final build result, with the log
+// lines of all results. If the builder sends the log lines of earlier results again with each
+// result, they are only collected once. An error is returned if reading the stream fails or if the stream
+// ends before the final result of the build. A failed build is not an error, the status of
+// the result is failed and the result contains the error reported by the builder.
+func (b *BuildResultStream) Collect() (BuildResult, error) {
+	return b.collect(nil)
+}
+
+// collect is like Collect but calls onResult with each result as it is received. The log
+// of the result passed to onResult only contains the lines that were not collected yet.
+func (b *BuildResultStream) collect(onResult func(BuildResult)) (BuildResult, error) {
+	final := BuildResult{}
+	for result, err := range b.Results() {
+		if err != nil {
+			return BuildResult{}, err
+		}
+
+		result.Log = newLogLines(final.Log, result.Log)
+		if onResult != nil {
+			onResult(result)
+		}
+
+		final.Log = append(final.Log, result.Log...)
+		if len(result.ID) > 0 {
+			final.ID = result.ID
+		}
+
+		if result.Status != BuildInProgress {
+			final.Image = result.Image
+			final.Status = result.Status
+			final.Error = result.Error
+			final.Digest = result.Digest
+			final.PlatformDigests = result.PlatformDigests
+		}
+		if result.Duration > 0 {
+			final.Duration = result.Duration
 		}
 	}
+
+	if len(final.Status) == 0 {
+		return final, fmt.Errorf("build log stream ended before the build completed")
+	}
+
+	return final, nil
 }
 
 // Close closes the build stream preventing further iteration.
 // The stream is automatically closed when you iterate through all results or when the iteration terminates
 func (b *BuildResultStream) Close() error {
+	if b.cancel != nil {
+		defer b.cancel()
+	}
 	return b.r.Close()
 }
 
+// TarOption is used to implement functional-style options that modify the
+// config used to create the build tar archive.
+type TarOption func(*TarConfig)
+
+// TarConfig is the config used to create the build tar archive.
+type TarConfig struct {
+	// ExcludePatterns are .dockerignore patterns for files that are excluded
+	// from the build context in addition to the patterns in the .dockerignore
+	// file of the build context.
+	ExcludePatterns []string
+
+	// Deterministic creates a reproducible archive. Timestamps and ownership
+	// are cleared and permissions are normalized, so identical sources
+	// produce an identical archive on any host.
+	Deterministic bool
+
+	// Symlinks is the policy for symbolic links in the build context.
+	// Links are preserved by default.
+	Symlinks SymlinkPolicy
+}
+
+// WithExcludePatterns is an option to exclude files from the build context with
+// .dockerignore patterns, in addition to the .dockerignore file of the build context.
+func WithExcludePatterns(patterns ...string) TarOption {
+	return func(c *TarConfig) {
+		c.ExcludePatterns = append(c.ExcludePatterns, patterns...)
+	}
+}
+
+// WithDeterministic is an option to create a reproducible tar archive. Entries are
+// written in lexical order, timestamps and ownership are cleared and permissions are
+// normalized to 0755 for directories and executables and 0644 for other files.
+func WithDeterministic() TarOption {
+	return func(c *TarConfig) {
+		c.Deterministic = true
+	}
+}
+
+// WithSymlinkPolicy is an option to configure how symbolic links in the build context are
+// added to the tar archive. Links that resolve outside of the build context are rejected
+// with either policy.
+func WithSymlinkPolicy(policy SymlinkPolicy) TarOption {
+	return func(c *TarConfig) {
+		c.Symlinks = policy
+	}
+}
+
+func newTarConfig(options []TarOption) *TarConfig {
+	c := &TarConfig{}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
 // MakeTar create a tar archive that contains the build config and build context.
-func MakeTar(tarPath string, context string, buildConfig *BuildConfig) error {
+// The build config is validated before the archive is created.
+//
+// Files that match the patterns in the .dockerignore file in the root of the build
+// context are excluded, using the same pattern semantics as Docker.
+//
+// Symbolic links are preserved unless the SymlinkFollow policy is set with the
+// WithSymlinkPolicy option. Links that resolve outside of the build context are
+// rejected. Sockets, devices and named pipes are skipped.
+func MakeTar(tarPath string, context string, buildConfig *BuildConfig, options ...TarOption) error {
+	if err := buildConfig.Validate(); err != nil {
+		return err
+	}
+
+	c := newTarConfig(options)
+
+	excludes, err := loadExcludeMatcher(os.DirFS(context), c.ExcludePatterns)
+	if err != nil {
+		return err
+	}
+
 	tarFile, err := os.Create(tarPath)
 	if err != nil {
 		return err
 	}
+	defer tarFile.Close()
 
-	tarWriter := tar.NewWriter(tarFile)
-	defer tarWriter.Close()
+	return writeBuildTar(tarFile, buildConfig, nil, func(tw *tar.Writer) error {
+		return writeDirContext(tw, context, excludes, c)
+	})
+}
 
-	if err = filepath.Walk(context, func(path string, f os.FileInfo, pathErr error) error {
-		if pathErr != nil {
-			return pathErr
-		}
+// ContextDigest returns the sha256 digest of the deterministic build tar archive for the
+// build context and build config, in the form "sha256:<hex>". The digest is equal to the
+// digest of the archive created by MakeTar with the WithDeterministic option, and can be
+// used to skip builds when the digest matches the digest of a previous successful build.
+// No archive is written to disk.
+func ContextDigest(context string, buildConfig *BuildConfig, options ...TarOption) (string, error) {
+	if err := buildConfig.Validate(); err != nil {
+		return "", err
+	}
 
-		targetFile, err := os.Open(path)
-		if err != nil {
-			return err
-		}
+	c := newTarConfig(append(options, WithDeterministic()))
+
+	excludes, err := loadExcludeMatcher(os.DirFS(context), c.ExcludePatterns)
+	if err != nil {
+		return "", err
+	}
 
-		header, err := tar.FileInfoHeader(f, f.Name())
+	h := sha256.New()
+	if err := writeBuildTar(h, buildConfig, nil, func(tw *tar.Writer) error {
+		return writeDirContext(tw, context, excludes, c)
+	}); err != nil {
+		return "", err
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeDirContext writes the files in the context directory that
+// are not excluded to the context folder of the tar archive.
+func writeDirContext(tw *tar.Writer, context string, excludes *excludeMatcher, c *TarConfig) error {
+	w, err := newContextWalker(context, excludes, c.Symlinks)
+	if err != nil {
+		return err
+	}
+
+	return w.walk(context, ".", func(src, name string, info fs.FileInfo, linkname string) error {
+		header, err := tar.FileInfoHeader(info, linkname)
 		if err != nil {
 			return err
 		}
 
-		header.Name = filepath.Join("context", strings.TrimPrefix(path, context))
-		header.Name = strings.TrimPrefix(header.Name, "/")
+		header.Name = path.Join("context", name)
+		if c.Deterministic {
+			normalizeHeader(header)
+		}
 
-		if err := tarWriter.WriteHeader(header); err != nil {
+		if err := tw.WriteHeader(header); err != nil {
 			return err
 		}
 
-		if f.Mode().IsDir() {
+		if header.Typeflag != tar.TypeReg {
 			return nil
 		}
 
-		_, err = io.Copy(tarWriter, targetFile)
-		return err
-	}); err != nil {
-		return err
-	}
-
-	configBytes, err := json.Marshal(buildConfig)
-	if err != nil {
-		return err
-	}
-
-	configHeader := &tar.Header{
-		Name: BuilderConfigFileName,
-		Mode: 0664,
-		Size: int64(len(configBytes)),
-	}
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
 
-	if err := tarWriter.WriteHeader(configHeader); err != nil {
+		_, err = io.Copy(tw, f)
 		return err
-	}
+	})
+}
 
-	if _, err := tarWriter.Write(configBytes); err != nil {
-		return err
+// normalizeHeader clears the timestamps and ownership of a tar header and
+// normalizes its permissions so archives are reproducible across hosts.
+func normalizeHeader(header *tar.Header) {
+	header.ModTime = time.Unix(0, 0)
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	header.Uid, header.Gid = 0, 0
+	header.Uname, header.Gname = "", ""
+	header.PAXRecords = nil
+	header.Format = tar.FormatUnknown
+
+	switch {
+	case header.Typeflag == tar.TypeSymlink:
+		header.Mode = 0777
+	case header.Typeflag == tar.TypeDir || header.Mode&0111 != 0:
+		header.Mode = 0755
+	default:
+		header.Mode = 0644
 	}
-
-	return err
 }
 
 const (
@@ -395,6 +818,15 @@ type BuildContextConfig struct {
 	// Path where the function handler should be overlayed
 	// in the selected template
 	TemplateHandlerOverlay string
+
+	// ExcludePatterns are .dockerignore patterns for handler files that are not
+	// copied into the build context, in addition to the patterns in the
+	// .dockerignore file of the handler.
+	ExcludePatterns []string
+
+	// Symlinks is the policy for symbolic links in the template, function handler
+	// and extra paths. Links are followed by default.
+	Symlinks SymlinkPolicy
 }
 
 // WithBuildDir is an option to configure the directory the build context is created in.
@@ -423,6 +855,25 @@ func WithHandlerOverlay(path string) BuildContextOption {
 	}
 }
 
+// WithHandlerExcludePatterns is an option to exclude handler files from the build
+// context with .dockerignore patterns, in addition to the .dockerignore file of the handler.
+func WithHandlerExcludePatterns(patterns ...string) BuildContextOption {
+	return func(c *BuildContextConfig) {
+		c.ExcludePatterns = append(c.ExcludePatterns, patterns...)
+	}
+}
+
+// WithContextSymlinkPolicy is an option to configure how symbolic links in the template,
+// function handler and extra paths are copied into the build context. Followed links in
+// the handler and extra paths must resolve within the current directory, links in the
+// template within the template. Preserved links in the handler must resolve within the
+// handler. Other links are rejected.
+func WithContextSymlinkPolicy(policy SymlinkPolicy) BuildContextOption {
+	return func(c *BuildContextConfig) {
+		c.Symlinks = policy
+	}
+}
+
 // CreateBuildContext create a Docker build context using the provided function handler and language template.
 //
 // Parameters:
@@ -436,6 +887,7 @@ func WithHandlerOverlay(path string) BuildContextOption {
 // directory can be overridden by setting the `builder.WithTemplateDir` option.
 // CreateBuildContext overlays the function handler in the `function` folder of the template by default.
 // This setting can be overridden by setting the `builder.WithHandlerOverlay` option.
+// Handler files that match the patterns in the .dockerignore file of the handler are not copied.
 //
 // The function returns the path to the build context, `./build/<functionName>` by default.
 // The build directory can be overridden by setting the `builder.WithBuildDir` option.
@@ -445,6 +897,7 @@ func CreateBuildContext(functionName string, handler string, language string, co
 		BuildDir:               DefaultBuildDir,
 		TemplateHandlerOverlay: DefaultTemplateHandler,
 		TemplateDir:            DefaultTemplateDir,
+		Symlinks:               SymlinkFollow,
 	}
 
 	for _, option := range options {
@@ -474,7 +927,11 @@ func CreateBuildContext(functionName string, handler string, language string, co
 
 	if language != "dockerfile" {
 		templateSrc := path.Join(c.TemplateDir, language)
-		if err := copyFiles(templateSrc, contextPath); err != nil {
+		w, err := newContextWalker(templateSrc, nil, c.Symlinks)
+		if err != nil {
+			return contextPath, fmt.Errorf("error copying template %s: %w", language, err)
+		}
+		if err := copyTree(w, templateSrc, contextPath, "."); err != nil {
 			return contextPath, fmt.Errorf("error copying template %s: %w", language, err)
 		}
 	}
@@ -486,20 +943,48 @@ func CreateBuildContext(functionName string, handler string, language string, co
 		return contextPath, fmt.Errorf("error reading function handler %s: %w", handlerSrc, err)
 	}
 
+	excludes, err := loadExcludeMatcher(os.DirFS(handlerSrc), c.ExcludePatterns)
+	if err != nil {
+		return contextPath, fmt.Errorf("error reading exclude patterns for function handler %s: %w", handlerSrc, err)
+	}
+
+	// Links in the handler may point to code shared by several functions elsewhere in the
+	// project, so followed links can resolve anywhere within the current directory, like
+	// the extra paths. Preserved links must resolve within the handler, as only the
+	// handler is copied into the build context.
+	handlerScope := handlerSrc
+	if c.Symlinks == SymlinkFollow {
+		if _, err := pathInScope(handlerSrc, "."); err == nil {
+			handlerScope = "."
+		}
+	}
+
+	handlerWalker, err := newContextWalker(handlerScope, excludes, c.Symlinks)
+	if err != nil {
+		return contextPath, fmt.Errorf("error reading function handler %s: %w", handlerSrc, err)
+	}
+
 	for _, info := range infos {
 		switch info.Name() {
 		case "build", "template":
 			continue
 		default:
-			if err := copyFiles(
+			if err := copyTree(
+				handlerWalker,
 				filepath.Clean(path.Join(handlerSrc, info.Name())),
 				filepath.Clean(path.Join(handlerDst, info.Name())),
+				info.Name(),
 			); err != nil {
 				return contextPath, err
 			}
 		}
 	}
 
+	extraWalker, err := newContextWalker(".", nil, c.Symlinks)
+	if err != nil {
+		return contextPath, err
+	}
+
 	for _, extraPath := range copyExtraPaths {
 		extraPathAbs, err := pathInScope(extraPath, ".")
 		if err != nil {
@@ -508,9 +993,11 @@ func CreateBuildContext(functionName string, handler string, language string, co
 		// Note that if template is nil or the language is `dockerfile`, then
 		// handlerDest == contextPath, the docker build context, not the handler folder
 		// inside the docker build context.
-		if err := copyFiles(
+		if err := copyTree(
+			extraWalker,
 			extraPathAbs,
 			filepath.Clean(path.Join(handlerDst, extraPath)),
+			filepath.ToSlash(filepath.Clean(extraPath)),
 		); err != nil {
 			return contextPath, fmt.Errorf("error copying extra paths: %w", err)
 		}
@@ -3,14 +3,22 @@ package builder
 import (
 	"archive/tar"
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	hmac "github.com/alexellis/hmac/v2"
 	"github.com/google/go-cmp/cmp"
@@ -55,8 +63,9 @@ func Test_BuildResultStream_Results(t *testing.T) {
 
 	// Verify the first result
 	wantFirst := BuildResult{
-		Log:    []string{"v: 2025-06-13T20:16:16Z [internal] load build definition from Dockerfile"},
-		Status: "in_progress",
+		Log:      []string{"v: 2025-06-13T20:16:16Z [internal] load build definition from Dockerfile"},
+		Status:   "in_progress",
+		Duration: 0.004,
 	}
 	if diff := cmp.Diff(wantFirst, results[0]); diff != "" {
 		t.Errorf("First result mismatch:\n%s", diff)
@@ -64,8 +73,9 @@ func Test_BuildResultStream_Results(t *testing.T) {
 
 	// Verify the last result
 	wantLast := BuildResult{
-		Image:  "ttl.sh/openfaas/test-image-hello:10m",
-		Status: "success",
+		Image:    "ttl.sh/openfaas/test-image-hello:10m",
+		Status:   "success",
+		Duration: 1.086,
 	}
 	if diff := cmp.Diff(wantLast, results[39]); diff != "" {
 		t.Errorf("Last result mismatch:\n%s", diff)
@@ -142,6 +152,168 @@ func Test_BuildResultStream_ReaderClosed(t *testing.T) {
 	})
 }
 
+func Test_BuildResultStream_Errors(t *testing.T) {
+	t.Run("decode error ends the stream", func(t *testing.T) {
+		data := `{"log":["step 1"],"status":"in_progress"}` + "\n{invalid\n" + `{"status":"success"}` + "\n"
+		stream := &BuildResultStream{r: io.NopCloser(strings.NewReader(data))}
+
+		var results []BuildResult
+		var errs []error
+		for result, err := range stream.Results() {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			results = append(results, result)
+		}
+
+		if len(results) != 1 {
+			t.Errorf("want 1 result before the decode error, got %d: %+v", len(results), results)
+		}
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), "unable to decode build result") {
+			t.Errorf("want a single decode error, got: %v", errs)
+		}
+	})
+
+	t.Run("lines longer than 64KB are decoded", func(t *testing.T) {
+		long := strings.Repeat("a", 256*1024)
+		data := `{"log":["` + long + `"],"status":"in_progress"}` + "\n" + `{"status":"success"}`
+		stream := &BuildResultStream{r: io.NopCloser(strings.NewReader(data))}
+
+		result, err := stream.Collect()
+		if err != nil {
+			t.Fatalf("Collect returned error: %v", err)
+		}
+		if len(result.Log) != 1 || result.Log[0] != long {
+			t.Fatalf("want long log line to be decoded, got %d lines", len(result.Log))
+		}
+		if result.Status != BuildSuccess {
+			t.Fatalf("want status %s, got %s", BuildSuccess, result.Status)
+		}
+	})
+
+	t.Run("read error is reported once", func(t *testing.T) {
+		readErr := errors.New("connection reset")
+		r := io.MultiReader(strings.NewReader(`{"status":"in_progress"}`+"\n"), iotest.ErrReader(readErr))
+		stream := &BuildResultStream{r: io.NopCloser(r)}
+
+		var errs []error
+		for _, err := range stream.Results() {
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) != 1 || !errors.Is(errs[0], readErr) {
+			t.Fatalf("want read error once, got: %v", errs)
+		}
+	})
+
+	t.Run("stream without final result", func(t *testing.T) {
+		stream := &BuildResultStream{r: io.NopCloser(strings.NewReader(`{"log":["step 1"],"status":"in_progress"}`))}
+		if _, err := stream.Collect(); err == nil {
+			t.Fatal("want error for stream that ended before the build completed")
+		}
+	})
+}
+
+func Test_BuildResultStream_Collect(t *testing.T) {
+	file, err := os.Open("../testdata/buildlogs.ndjson")
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+
+	stream := &BuildResultStream{r: file}
+	result, err := stream.Collect()
+	if err != nil {
+		t.Fatalf("Collect returned error: %v", err)
+	}
+
+	if result.Status != BuildSuccess || result.Image != "ttl.sh/openfaas/test-image-hello:10m" {
+		t.Errorf("want final result, got status %q and image %q", result.Status, result.Image)
+	}
+	if want := 1086 * time.Millisecond; result.Elapsed() != want {
+		t.Errorf("want build duration %s, got %s", want, result.Elapsed())
+	}
+	if want := "v: 2025-06-13T20:16:17Z exporting to image 0.02s"; !slices.Contains(result.Log, want) {
+		t.Errorf("want log of all results, got %d lines", len(result.Log))
+	}
+
+	t.Run("cumulative logs are collected once", func(t *testing.T) {
+		data := `{"log":["step 1"],"status":"in_progress"}` + "\n" +
+			`{"log":["step 1","step 2"],"status":"in_progress"}` + "\n" +
+			`{"log":["step 1","step 2","step 3"],"status":"in_progress"}` + "\n" +
+			`{"log":["step 1","step 2","step 3"],"status":"success"}` + "\n"
+		stream := &BuildResultStream{r: io.NopCloser(strings.NewReader(data))}
+
+		var streamed []string
+		result, err := stream.collect(func(result BuildResult) {
+			streamed = append(streamed, result.Log...)
+		})
+		if err != nil {
+			t.Fatalf("collect returned error: %v", err)
+		}
+
+		want := []string{"step 1", "step 2", "step 3"}
+		if diff := cmp.Diff(want, result.Log); diff != "" {
+			t.Errorf("collected log mismatch (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff(want, streamed); diff != "" {
+			t.Errorf("streamed log mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func Test_BuildWithStreamContext_Cancel(t *testing.T) {
+	requestDone := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+
+		w.Write([]byte(`{"log":["step 1"],"status":"in_progress"}` + "\n"))
+		w.(http.Flusher).Flush()
+
+		<-r.Context().Done()
+		close(requestDone)
+	}))
+	defer server.Close()
+
+	tarPath := filepath.Join(t.TempDir(), "build.tar")
+	if err := os.WriteFile(tarPath, createTestTar(t), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(server.URL)
+	b := NewFunctionBuilder(u, http.DefaultClient)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	stream, err := b.BuildWithStreamContext(ctx, tarPath)
+	if err != nil {
+		t.Fatalf("BuildWithStreamContext returned error: %v", err)
+	}
+
+	var gotErr error
+	for result, err := range stream.Results() {
+		if err != nil {
+			gotErr = err
+			break
+		}
+		if result.Status == BuildInProgress {
+			cancel()
+		}
+	}
+
+	if !errors.Is(gotErr, context.Canceled) {
+		t.Fatalf("want context.Canceled, got: %v", gotErr)
+	}
+
+	select {
+	case <-requestDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want build request to be cancelled")
+	}
+}
+
 func TestBuildWithSecrets(t *testing.T) {
 	pub, priv, err := seal.GenerateKeyPair()
 	if err != nil {
@@ -258,3 +430,136 @@ func createTestTar(t *testing.T) []byte {
 	}
 	return buf.Bytes()
 }
+
+func TestBuild_StreamsTarWithSignature(t *testing.T) {
+	pub, priv, err := seal.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("seal.GenerateKeyPair: %v", err)
+	}
+
+	// Build a tar with a large file so the upload spans many pipe writes. The file
+	// ends with zero blocks that must not be mistaken for the end of the archive.
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	large := append(bytes.Repeat([]byte("0123456789abcdef"), 256*1024), make([]byte, 2048)...)
+	if err := tw.WriteHeader(&tar.Header{Name: "context/model.bin", Mode: 0644, Size: int64(len(large))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(large); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tarPath := t.TempDir() + "/build.tar"
+	if err := os.WriteFile(tarPath, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		secrets map[string]string
+	}{
+		{name: "without build secrets"},
+		{name: "with build secrets", secrets: map[string]string{"pip_token": "s3cr3t"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Respond with the headers before the upload is read, like
+				// a builder that streams the build logs.
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("io.ReadAll returned error: %v", err)
+					return
+				}
+
+				if r.ContentLength != int64(len(body)) || len(r.TransferEncoding) > 0 {
+					t.Errorf("want content length %d, got %d with transfer encoding %v", len(body), r.ContentLength, r.TransferEncoding)
+				}
+
+				wantDigest := hmac.Sign(body, []byte("payload-secret"), sha256.New)
+				if got := r.Header.Get("X-Build-Signature"); got != "sha256="+hex.EncodeToString(wantDigest) {
+					t.Errorf("unexpected signature: %s", got)
+				}
+
+				files := map[string][]byte{}
+				tr := tar.NewReader(bytes.NewReader(body))
+				for {
+					hdr, err := tr.Next()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Errorf("tar.Next returned error: %v", err)
+						return
+					}
+					files[hdr.Name], _ = io.ReadAll(tr)
+				}
+
+				if !bytes.Equal(files["context/model.bin"], large) {
+					t.Errorf("large file was not uploaded intact")
+				}
+
+				_, hasSecrets := files[BuildSecretsFileName]
+				if hasSecrets != (test.secrets != nil) {
+					t.Errorf("want sealed secrets in tar: %v, got: %v", test.secrets != nil, hasSecrets)
+				}
+				if hasSecrets {
+					secrets, err := seal.Unseal(priv, files[BuildSecretsFileName])
+					if err != nil || string(secrets["pip_token"]) != "s3cr3t" {
+						t.Errorf("unable to unseal build secrets: %v", err)
+					}
+				}
+
+				io.WriteString(w, `{"status":"success","image":"ttl.sh/test:latest"}`)
+			}))
+			defer server.Close()
+
+			serverURL, _ := url.Parse(server.URL)
+			builder := NewFunctionBuilder(serverURL, http.DefaultClient,
+				WithHmacAuth("payload-secret"),
+				WithBuildSecretsKey(pub))
+
+			result, err := builder.BuildWithSecrets(tarPath, test.secrets)
+			if err != nil {
+				t.Fatalf("BuildWithSecrets returned error: %v", err)
+			}
+			if result.Status != BuildSuccess {
+				t.Fatalf("want status %q, got %q", BuildSuccess, result.Status)
+			}
+		})
+	}
+}
+
+func TestBuild_ContextChangedWhileSending(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		io.WriteString(w, `{"status":"success"}`)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	builder := NewFunctionBuilder(serverURL, http.DefaultClient, WithHmacAuth("payload-secret"))
+
+	var calls int
+	writeTar := func(w io.Writer) error {
+		calls++
+		_, err := fmt.Fprintf(w, "context-%d", calls)
+		return err
+	}
+
+	res, err := builder.send(context.Background(), writeTar, buildModeResult)
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("want error when the build context changes between the signed and the sent archive")
+	}
+	if !strings.Contains(err.Error(), "does not match its signature") {
+		t.Fatalf("want signature mismatch error, got: %v", err)
+	}
+}
@@ -5,53 +5,60 @@ package builder
 import (
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 )
 
-// copyFiles copies files from src to destination.
+// copyFiles copies files from src to destination. Symbolic links
+// are followed as long as they resolve within src.
 func copyFiles(src, dest string) error {
-	info, err := os.Stat(src)
+	w, err := newContextWalker(src, nil, SymlinkFollow)
 	if err != nil {
 		return err
 	}
 
-	if info.IsDir() {
-		debugPrint(fmt.Sprintf("Creating directory: %s at %s", info.Name(), dest))
-		return copyDir(src, dest)
-	}
-
-	debugPrint(fmt.Sprintf("cp - %s %s", src, dest))
-	return copyFile(src, dest)
+	return copyTree(w, src, dest, ".")
 }
 
-// copyDir will recursively copy a directory to dest
-func copyDir(src, dest string) error {
-	info, err := os.Stat(src)
-	if err != nil {
-		return fmt.Errorf("error reading dest stats: %s", err.Error())
-	}
-
-	if err := os.MkdirAll(dest, info.Mode()); err != nil {
-		return fmt.Errorf("error creating path: %s - %s", dest, err.Error())
-	}
+// copyTree copies the file or directory src to destination. Paths excluded by the
+// walker are skipped and symbolic links are handled according to its symlink policy.
+// relPath is the slash separated path of src relative to the root of the walker.
+// Excluded directories are not created, only the files in them that are re-included
+// by an exception pattern are copied.
+func copyTree(w *contextWalker, src, dest, relPath string) error {
+	return w.walk(src, relPath, func(src, name string, info fs.FileInfo, linkname string) error {
+		target := filepath.Join(dest, filepath.FromSlash(name))
+
+		if info.IsDir() {
+			debugPrint(fmt.Sprintf("Creating directory: %s at %s", info.Name(), target))
+			if err := os.MkdirAll(target, info.Mode()); err != nil {
+				return fmt.Errorf("error creating path: %s - %s", target, err.Error())
+			}
+			return nil
+		}
 
-	infos, err := os.ReadDir(src)
-	if err != nil {
-		return err
-	}
+		// Replace files and links from a previous copy, i.e. a template
+		// file that is overlayed by the function handler, instead of
+		// writing through an existing link.
+		if existing, err := os.Lstat(target); err == nil && !existing.IsDir() {
+			if err := os.Remove(target); err != nil {
+				return fmt.Errorf("error replacing dest file: %w", err)
+			}
+		}
 
-	for _, info := range infos {
-		if err := copyFiles(
-			filepath.Join(src, info.Name()),
-			filepath.Join(dest, info.Name()),
-		); err != nil {
-			return err
+		if len(linkname) > 0 {
+			debugPrint(fmt.Sprintf("ln -s %s %s", linkname, target))
+			if err := ensureBaseDir(target); err != nil {
+				return fmt.Errorf("error creating dest base directory: %w", err)
+			}
+			return os.Symlink(filepath.FromSlash(linkname), target)
 		}
-	}
 
-	return nil
+		debugPrint(fmt.Sprintf("cp - %s %s", src, target))
+		return copyFile(src, target)
+	})
 }
 
 // copyFile will copy a file with the same mode as the src file
@@ -0,0 +1,231 @@
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DockerignoreFileName is the name of the file with exclude patterns for the build context.
+const DockerignoreFileName = ".dockerignore"
+
+// excludePattern is a single pattern of a .dockerignore file.
+type excludePattern struct {
+	cleaned   string
+	re        *regexp.Regexp
+	exception bool
+	depth     int
+}
+
+// excludeMatcher matches paths against .dockerignore patterns with the same
+// semantics as Docker:
+//
+//   - '*' matches any sequence of non-separator characters, '?' a single
+//     non-separator character and '[...]' a character class.
+//   - '**' matches any number of directories, including none.
+//   - Patterns starting with '!' are exceptions that re-include matching paths.
+//   - The last pattern that matches a path decides whether it is excluded.
+//   - A pattern that matches a directory excludes everything in it.
+type excludeMatcher struct {
+	patterns      []excludePattern
+	hasExceptions bool
+}
+
+// newExcludeMatcher compiles the exclude patterns. Empty patterns
+// and comments are ignored.
+func newExcludeMatcher(patterns []string) (*excludeMatcher, error) {
+	m := &excludeMatcher{}
+
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if len(p) == 0 || strings.HasPrefix(p, "#") {
+			continue
+		}
+
+		exception := false
+		if p[0] == '!' {
+			exception = true
+			p = strings.TrimSpace(p[1:])
+			if len(p) == 0 {
+				return nil, fmt.Errorf("illegal exclusion pattern: %q", "!")
+			}
+		}
+
+		p = path.Clean(p)
+		p = strings.TrimPrefix(p, "/")
+		if p == "." || len(p) == 0 {
+			// Docker ignores patterns that match the root of the context.
+			continue
+		}
+
+		re, err := patternRegexp(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", p, err)
+		}
+
+		m.patterns = append(m.patterns, excludePattern{
+			cleaned:   p,
+			re:        re,
+			exception: exception,
+			depth:     len(strings.Split(p, "/")),
+		})
+
+		if exception {
+			m.hasExceptions = true
+		}
+	}
+
+	return m, nil
+}
+
+// patternRegexp converts a .dockerignore pattern to an anchored regular expression.
+func patternRegexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+		switch {
+		case ch == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			i++
+			if i+1 < len(pattern) && pattern[i+1] == '/' {
+				// "**/" matches zero or more directories.
+				i++
+				sb.WriteString("(.*/)?")
+			} else {
+				sb.WriteString(".*")
+			}
+		case ch == '*':
+			sb.WriteString("[^/]*")
+		case ch == '?':
+			sb.WriteString("[^/]")
+		case ch == '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			} else {
+				sb.WriteString(`\\`)
+			}
+		case ch == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return nil, errors.New("unterminated character class")
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// excluded reports whether the slash separated path, relative to the
+// root of the build context, is excluded by the patterns.
+func (m *excludeMatcher) excluded(relPath string) bool {
+	if m == nil {
+		return false
+	}
+
+	parents := strings.Split(path.Dir(relPath), "/")
+
+	matched := false
+	for _, p := range m.patterns {
+		match := p.re.MatchString(relPath)
+
+		// A pattern that matches a parent directory matches everything in it.
+		if !match && parents[0] != "." && len(parents) >= p.depth {
+			match = p.re.MatchString(strings.Join(parents[:p.depth], "/"))
+		}
+
+		if match {
+			matched = !p.exception
+		}
+	}
+
+	return matched
+}
+
+// skipDir reports whether an excluded directory can be skipped entirely,
+// which is the case unless an exception pattern may match a path in it.
+func (m *excludeMatcher) skipDir(relDir string) bool {
+	if !m.hasExceptions {
+		return true
+	}
+
+	dirSlash := relDir + "/"
+	for _, p := range m.patterns {
+		if p.exception && strings.HasPrefix(p.cleaned+"/", dirSlash) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readExcludePatterns reads the patterns of a .dockerignore file.
+func readExcludePatterns(r io.Reader) ([]string, error) {
+	var patterns []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Strip a UTF-8 byte order mark from the first line.
+		line := string(bytes.TrimPrefix(scanner.Bytes(), []byte("\xef\xbb\xbf")))
+		patterns = append(patterns, line)
+	}
+
+	return patterns, scanner.Err()
+}
+
+// loadExcludeMatcher creates a matcher for the .dockerignore file in the root of
+// fsys, if it exists, and the extra patterns. The Dockerfile and .dockerignore file
+// are never excluded as the builder needs them, like with `docker build`.
+func loadExcludeMatcher(fsys fs.FS, extraPatterns []string) (*excludeMatcher, error) {
+	var patterns []string
+
+	f, err := fsys.Open(DockerignoreFileName)
+	if err == nil {
+		patterns, err = readExcludePatterns(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", DockerignoreFileName, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("unable to read %s: %w", DockerignoreFileName, err)
+	}
+
+	return newContextExcludeMatcher(patterns, extraPatterns)
+}
+
+// newContextExcludeMatcher creates a matcher for the patterns of the .dockerignore
+// file of a build context and the extra patterns. It returns nil if there are no
+// patterns. The Dockerfile and .dockerignore file are never excluded.
+func newContextExcludeMatcher(patterns, extraPatterns []string) (*excludeMatcher, error) {
+	patterns = append(patterns[:len(patterns):len(patterns)], extraPatterns...)
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	m, err := newExcludeMatcher(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.excluded("Dockerfile") || m.excluded(DockerignoreFileName) {
+		return newExcludeMatcher(append(patterns, "!Dockerfile", "!"+DockerignoreFileName))
+	}
+
+	return m, nil
+}
@@ -0,0 +1,180 @@
+package builder
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_excludeMatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{name: "exact file", patterns: []string{"secret.txt"}, path: "secret.txt", want: true},
+		{name: "pattern is anchored at the root", patterns: []string{"secret.txt"}, path: "sub/secret.txt", want: false},
+		{name: "leading slash", patterns: []string{"/secret.txt"}, path: "secret.txt", want: true},
+		{name: "directory excludes children", patterns: []string{"node_modules"}, path: "node_modules/lodash/index.js", want: true},
+		{name: "star does not cross directories", patterns: []string{"*.log"}, path: "logs/app.log", want: false},
+		{name: "star in directory", patterns: []string{"*/*.log"}, path: "logs/app.log", want: true},
+		{name: "double star matches any depth", patterns: []string{"**/*.pyc"}, path: "a/b/c/mod.pyc", want: true},
+		{name: "double star matches root", patterns: []string{"**/*.pyc"}, path: "mod.pyc", want: true},
+		{name: "double star in the middle", patterns: []string{"a/**/z"}, path: "a/b/c/z", want: true},
+		{name: "double star in the middle matches zero dirs", patterns: []string{"a/**/z"}, path: "a/z", want: true},
+		{name: "question mark", patterns: []string{"file?.txt"}, path: "file1.txt", want: true},
+		{name: "character class", patterns: []string{"file[0-9].txt"}, path: "filea.txt", want: false},
+		{name: "negation re-includes", patterns: []string{"*.md", "!README.md"}, path: "README.md", want: false},
+		{name: "last match wins", patterns: []string{"!README.md", "*.md"}, path: "README.md", want: true},
+		{name: "comments are ignored", patterns: []string{"# secret.txt"}, path: "secret.txt", want: false},
+		{name: "escaped wildcard", patterns: []string{`\*.txt`}, path: "*.txt", want: true},
+		{name: "escaped wildcard is literal", patterns: []string{`\*.txt`}, path: "a.txt", want: false},
+		{name: "git directory", patterns: []string{".git"}, path: ".git/objects/ab/cdef", want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := newExcludeMatcher(test.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := m.excluded(test.path); got != test.want {
+				t.Fatalf("want excluded(%q) with patterns %q to be %v, got %v", test.path, test.patterns, test.want, got)
+			}
+		})
+	}
+}
+
+func Test_MakeTar_Dockerignore(t *testing.T) {
+	contextDir := t.TempDir()
+	writeTestFiles(t, contextDir, map[string]string{
+		"Dockerfile":                   "FROM scratch\n",
+		".dockerignore":                "# build outputs\n.git\nnode_modules\n**/*.log\ndocs\n!docs/keep.md\nDockerfile\n",
+		"index.js":                     "",
+		".git/HEAD":                    "",
+		"node_modules/lodash/index.js": "",
+		"src/app.js":                   "",
+		"src/debug.log":                "",
+		"docs/keep.md":                 "",
+		"docs/other.md":                "",
+		"tmp/cache":                    "",
+	})
+
+	tarPath := filepath.Join(t.TempDir(), "build.tar")
+	if err := MakeTar(tarPath, contextDir, &BuildConfig{Image: "test"}, WithExcludePatterns("tmp")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := readTarFiles(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		BuilderConfigFileName,
+		"context",
+		"context/.dockerignore",
+		"context/Dockerfile",
+		"context/docs/keep.md",
+		"context/index.js",
+		"context/src",
+		"context/src/app.js",
+	}
+
+	if diff := cmp.Diff(want, sortedKeys(files)); diff != "" {
+		t.Fatalf("tar entries mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_WriteTar_Dockerignore(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Dockerfile":    {Data: []byte("FROM scratch\n")},
+		".dockerignore": {Data: []byte("*.secret\n")},
+		"app.secret":    {Data: []byte("s3cr3t")},
+		"app.py":        {Data: []byte("")},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTar(&buf, fsys, &BuildConfig{Image: "test"}, WithExcludePatterns("app.py")); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := readTarFiles(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{BuilderConfigFileName, "context", "context/.dockerignore", "context/Dockerfile"}
+	if diff := cmp.Diff(want, sortedKeys(files)); diff != "" {
+		t.Fatalf("tar entries mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_CreateBuildContext_Dockerignore(t *testing.T) {
+	handlerDir := t.TempDir()
+	writeTestFiles(t, handlerDir, map[string]string{
+		"Dockerfile":                "FROM scratch\n",
+		".dockerignore":             "node_modules\n",
+		"index.js":                  "",
+		"node_modules/dep/index.js": "",
+		"coverage/lcov.info":        "",
+	})
+
+	buildDir := t.TempDir()
+	contextPath, err := CreateBuildContext("fn", handlerDir, "dockerfile", nil,
+		WithBuildDir(buildDir),
+		WithHandlerExcludePatterns("coverage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	filepath.Walk(contextPath, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(contextPath, p)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(got)
+
+	want := []string{".dockerignore", "Dockerfile", "index.js"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("build context files mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, strings.TrimSuffix(k, "/"))
+	}
+	sort.Strings(keys)
+	return keys
+}
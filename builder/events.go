@@ -0,0 +1,311 @@
+package builder
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BuildEventType is the type of a build log event.
+type BuildEventType string
+
+const (
+	// BuildEventStepStarted is reported when a build step starts.
+	BuildEventStepStarted BuildEventType = "step_started"
+
+	// BuildEventStepCompleted is reported when a build step completes, with its duration.
+	BuildEventStepCompleted BuildEventType = "step_completed"
+
+	// BuildEventProgress reports the progress of a step, i.e. transferring the build context.
+	BuildEventProgress BuildEventType = "progress"
+
+	// BuildEventLog is output of a build step, i.e. of a RUN instruction.
+	BuildEventLog BuildEventType = "log"
+
+	// BuildEventWarning is a warning reported by the builder.
+	BuildEventWarning BuildEventType = "warning"
+
+	// BuildEventError is an error reported by the builder.
+	BuildEventError BuildEventType = "error"
+)
+
+// BuildEvent is a typed event parsed from a line of the build log.
+type BuildEvent struct {
+	Type BuildEventType
+
+	// Time the event was reported by the builder, if known.
+	Time time.Time
+
+	// Name of the step or progress item, i.e. "[build 2/16] RUN make".
+	Name string
+
+	// Duration of a completed step.
+	Duration time.Duration
+
+	// Cached is set for steps that were served from the build cache.
+	Cached bool
+
+	// Current is the progress of a progress event, i.e. the bytes transferred.
+	Current int64
+
+	// Message of a log, warning or error event.
+	Message string
+
+	// Line is the original log line.
+	Line string
+}
+
+var stepDurationRegexp = regexp.MustCompile(`^[0-9]+(?:\.[0-9]+)?s$`)
+
+// ParseBuildEvent parses a line of the build log. Lines have the form
+// "<type>: <RFC3339 time> <text>" where the type is one of:
+//
+//   - v: a build step, followed by its duration, i.e. "0.52s", when it completed. Steps
+//     served from the cache end with "CACHED", failed steps with "ERROR: <message>".
+//   - s: the progress of a step, the text ends with the current progress.
+//   - l: output of a build step.
+//   - w: a warning.
+//   - e: an error.
+//
+// Lines in another format are returned as log events.
+func ParseBuildEvent(line string) BuildEvent {
+	event := BuildEvent{Type: BuildEventLog, Message: line, Line: line}
+
+	kind, rest, ok := strings.Cut(line, ": ")
+	if !ok || len(kind) != 1 {
+		return event
+	}
+
+	timestamp, text, _ := strings.Cut(rest, " ")
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return event
+	}
+	event.Time = t
+
+	switch kind {
+	case "v":
+		event.Type = BuildEventStepStarted
+		event.Message = ""
+
+		if name, message, ok := strings.Cut(text, " ERROR: "); ok {
+			event.Type = BuildEventError
+			event.Name = name
+			event.Message = message
+			return event
+		}
+
+		if name, ok := strings.CutSuffix(text, " CACHED"); ok {
+			event.Cached = true
+			text = name
+		}
+
+		if i := strings.LastIndexByte(text, ' '); i > 0 && stepDurationRegexp.MatchString(text[i+1:]) {
+			seconds, _ := strconv.ParseFloat(strings.TrimSuffix(text[i+1:], "s"), 64)
+			event.Type = BuildEventStepCompleted
+			event.Duration = time.Duration(seconds * float64(time.Second))
+			text = text[:i]
+		}
+
+		event.Name = text
+	case "s":
+		event.Type = BuildEventProgress
+		event.Message = ""
+		event.Name = text
+		if i := strings.LastIndexByte(text, ' '); i > 0 {
+			if current, err := strconv.ParseInt(text[i+1:], 10, 64); err == nil {
+				event.Name = text[:i]
+				event.Current = current
+			}
+		}
+	case "l":
+		event.Message = text
+	case "w":
+		event.Type = BuildEventWarning
+		event.Message = text
+	case "e":
+		event.Type = BuildEventError
+		event.Message = text
+	default:
+		event.Time = time.Time{}
+	}
+
+	return event
+}
+
+// Events returns the typed events of the build log of the result. An error
+// event is added if the result has an error message.
+func (r BuildResult) Events() []BuildEvent {
+	events := make([]BuildEvent, 0, len(r.Log))
+	for _, line := range r.Log {
+		events = append(events, ParseBuildEvent(line))
+	}
+
+	if len(r.Error) > 0 {
+		events = append(events, BuildEvent{Type: BuildEventError, Message: r.Error, Line: r.Error})
+	}
+
+	return events
+}
+
+// Elapsed returns the time since the build started, as reported by the builder,
+// rounded to the microsecond. It is zero if the builder did not report it.
+func (r BuildResult) Elapsed() time.Duration {
+	return time.Duration(math.Round(r.Duration*1e6)) * time.Microsecond
+}
+
+// BuildStep is the timing of a build step.
+type BuildStep struct {
+	// Name of the step, i.e. "[build 2/16] RUN make".
+	Name string
+
+	// Started is the time the step started.
+	Started time.Time
+
+	// Duration of the step, zero until the step completed.
+	Duration time.Duration
+
+	// Completed is set once the step completed.
+	Completed bool
+
+	// Cached is set if the step was served from the build cache.
+	Cached bool
+
+	// Error is the error message if the step failed.
+	Error string
+}
+
+// BuildSummary aggregates the results of a build, i.e. of a BuildResultStream,
+// into the final status, image digests, step timings and reported problems.
+type BuildSummary struct {
+	// Image, Status and Error of the final build result.
+	Image  string
+	Status string
+	Error  string
+
+	// Digest of the pushed image manifest, or the manifest list of a multi-arch build.
+	// If the builder does not report the digest, it is taken from the build log.
+	Digest string
+
+	// PlatformDigests are the manifest digests by platform of a multi-arch build.
+	PlatformDigests map[string]string
+
+	// Duration of the build, from the last result that reported it.
+	Duration time.Duration
+
+	// Steps in the order they started.
+	Steps []BuildStep
+
+	// CacheHits is the number of steps that were served from the build cache.
+	CacheHits int
+
+	// Warnings and Errors reported during the build.
+	Warnings []string
+	Errors   []string
+
+	steps          map[string]int
+	reportedDigest string
+	manifests      []string
+	manifestList   string
+}
+
+// Add adds a build result to the summary.
+func (s *BuildSummary) Add(result BuildResult) {
+	for _, event := range result.Events() {
+		s.addEvent(event)
+	}
+
+	if len(result.Status) > 0 {
+		s.Status = result.Status
+	}
+	if len(result.Image) > 0 {
+		s.Image = result.Image
+	}
+	if len(result.Error) > 0 {
+		s.Error = result.Error
+	}
+	if len(result.Digest) > 0 {
+		s.reportedDigest = result.Digest
+	}
+	if result.Duration > 0 {
+		s.Duration = result.Elapsed()
+	}
+	for platform, digest := range result.PlatformDigests {
+		if s.PlatformDigests == nil {
+			s.PlatformDigests = map[string]string{}
+		}
+		s.PlatformDigests[platform] = digest
+	}
+
+	s.Digest = s.reportedDigest
+	if len(s.Digest) == 0 {
+		s.Digest = s.logDigest()
+	}
+}
+
+func (s *BuildSummary) addEvent(event BuildEvent) {
+	switch event.Type {
+	case BuildEventStepStarted, BuildEventStepCompleted:
+		step := s.step(event)
+		if event.Cached && !step.Cached {
+			step.Cached = true
+			s.CacheHits++
+		}
+		if event.Type == BuildEventStepCompleted {
+			step.Completed = true
+			step.Duration = event.Duration
+		}
+	case BuildEventProgress:
+		if digest, ok := strings.CutPrefix(event.Name, "exporting manifest list "); ok {
+			s.manifestList = digest
+		} else if digest, ok := strings.CutPrefix(event.Name, "exporting manifest "); ok {
+			s.addManifest(digest)
+		}
+	case BuildEventWarning:
+		s.Warnings = append(s.Warnings, event.Message)
+	case BuildEventError:
+		if len(event.Name) > 0 {
+			s.step(event).Error = event.Message
+		}
+		s.Errors = append(s.Errors, event.Message)
+	}
+}
+
+// step returns the step of the event, the step is added if it did not start yet.
+func (s *BuildSummary) step(event BuildEvent) *BuildStep {
+	if s.steps == nil {
+		s.steps = map[string]int{}
+	}
+
+	i, ok := s.steps[event.Name]
+	if !ok {
+		i = len(s.Steps)
+		s.steps[event.Name] = i
+		s.Steps = append(s.Steps, BuildStep{Name: event.Name, Started: event.Time})
+	}
+
+	return &s.Steps[i]
+}
+
+func (s *BuildSummary) addManifest(digest string) {
+	for _, d := range s.manifests {
+		if d == digest {
+			return
+		}
+	}
+	s.manifests = append(s.manifests, digest)
+}
+
+// logDigest returns the digest of the pushed image from the build log. A single
+// platform build exports one manifest, a multi-arch build exports a manifest list.
+func (s *BuildSummary) logDigest() string {
+	if len(s.manifestList) > 0 {
+		return s.manifestList
+	}
+	if len(s.manifests) == 1 {
+		return s.manifests[0]
+	}
+	return ""
+}
@@ -0,0 +1,158 @@
+package builder
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_ParseBuildEvent(t *testing.T) {
+	ts := time.Date(2025, 6, 13, 20, 16, 16, 0, time.UTC)
+
+	tests := []struct {
+		line string
+		want BuildEvent
+	}{
+		{
+			line: "v: 2025-06-13T20:16:16Z [build 2/16] RUN make",
+			want: BuildEvent{Type: BuildEventStepStarted, Time: ts, Name: "[build 2/16] RUN make"},
+		},
+		{
+			line: "v: 2025-06-13T20:16:16Z [build 2/16] RUN make 1.25s",
+			want: BuildEvent{Type: BuildEventStepCompleted, Time: ts, Name: "[build 2/16] RUN make", Duration: 1250 * time.Millisecond},
+		},
+		{
+			line: "v: 2025-06-13T20:16:16Z [build 3/16] COPY . . CACHED",
+			want: BuildEvent{Type: BuildEventStepStarted, Time: ts, Name: "[build 3/16] COPY . .", Cached: true},
+		},
+		{
+			line: "v: 2025-06-13T20:16:16Z [build 4/16] RUN go test ERROR: exit code 1",
+			want: BuildEvent{Type: BuildEventError, Time: ts, Name: "[build 4/16] RUN go test", Message: "exit code 1"},
+		},
+		{
+			line: "s: 2025-06-13T20:16:16Z transferring context 4096",
+			want: BuildEvent{Type: BuildEventProgress, Time: ts, Name: "transferring context", Current: 4096},
+		},
+		{
+			line: "l: 2025-06-13T20:16:16Z go: downloading github.com/openfaas/go-sdk",
+			want: BuildEvent{Type: BuildEventLog, Time: ts, Message: "go: downloading github.com/openfaas/go-sdk"},
+		},
+		{
+			line: "w: 2025-06-13T20:16:16Z FromAsCasing: 'as' and 'FROM' keywords' casing do not match",
+			want: BuildEvent{Type: BuildEventWarning, Time: ts, Message: "FromAsCasing: 'as' and 'FROM' keywords' casing do not match"},
+		},
+		{
+			line: "e: 2025-06-13T20:16:16Z failed to push image",
+			want: BuildEvent{Type: BuildEventError, Time: ts, Message: "failed to push image"},
+		},
+		{
+			line: "Step 1/5 : FROM scratch",
+			want: BuildEvent{Type: BuildEventLog, Message: "Step 1/5 : FROM scratch"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			test.want.Line = test.line
+			if diff := cmp.Diff(test.want, ParseBuildEvent(test.line)); diff != "" {
+				t.Fatalf("event mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_BuildSummary(t *testing.T) {
+	file, err := os.Open("../testdata/buildlogs.ndjson")
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer file.Close()
+
+	stream := &BuildResultStream{r: file}
+
+	var summary BuildSummary
+	for result, err := range stream.Results() {
+		if err != nil {
+			t.Fatalf("Unexpected error from stream: %v", err)
+		}
+		summary.Add(result)
+	}
+
+	if summary.Status != BuildSuccess {
+		t.Errorf("want status %s, got %s", BuildSuccess, summary.Status)
+	}
+	if want := "ttl.sh/openfaas/test-image-hello:10m"; summary.Image != want {
+		t.Errorf("want image %s, got %s", want, summary.Image)
+	}
+	if want := "sha256:0c7b53662025d6f589716a455d9846878975a1bb0a6eb429a206acaf94285078"; summary.Digest != want {
+		t.Errorf("want digest from the build log %s, got %s", want, summary.Digest)
+	}
+
+	if want := 1086 * time.Millisecond; summary.Duration != want {
+		t.Errorf("want build duration %s, got %s", want, summary.Duration)
+	}
+
+	wantDurations := map[string]time.Duration{
+		"[internal] load metadata for docker.io/library/python:3.12-alpine": 840 * time.Millisecond,
+		"exporting to image": 20 * time.Millisecond,
+	}
+	for name, want := range wantDurations {
+		var found bool
+		for _, step := range summary.Steps {
+			if step.Name != name {
+				continue
+			}
+			found = true
+			if !step.Completed || step.Duration != want {
+				t.Errorf("want step %q completed in %s, got %+v", name, want, step)
+			}
+		}
+		if !found {
+			t.Errorf("want step %q in summary", name)
+		}
+	}
+
+	t.Run("digest reported by the builder is preferred", func(t *testing.T) {
+		var summary BuildSummary
+		summary.Add(BuildResult{Log: []string{"s: 2025-06-13T20:16:17Z exporting manifest sha256:aaaa 0"}, Status: BuildInProgress})
+		summary.Add(BuildResult{
+			Status:          BuildSuccess,
+			Digest:          "sha256:bbbb",
+			PlatformDigests: map[string]string{"linux/amd64": "sha256:aaaa"},
+		})
+		summary.Add(BuildResult{Log: []string{"s: 2025-06-13T20:16:17Z exporting manifest list sha256:cccc 0"}})
+
+		if summary.Digest != "sha256:bbbb" {
+			t.Errorf("want digest sha256:bbbb, got %s", summary.Digest)
+		}
+		if diff := cmp.Diff(map[string]string{"linux/amd64": "sha256:aaaa"}, summary.PlatformDigests); diff != "" {
+			t.Errorf("platform digests mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("steps, cache hits and errors", func(t *testing.T) {
+		var summary BuildSummary
+		summary.Add(BuildResult{Log: []string{
+			"v: 2025-06-13T20:16:16Z [build 1/3] COPY . . CACHED",
+			"v: 2025-06-13T20:16:16Z [build 2/3] RUN make",
+			"w: 2025-06-13T20:16:16Z deprecated syntax",
+			"v: 2025-06-13T20:16:17Z [build 2/3] RUN make ERROR: exit code 2",
+		}})
+		summary.Add(BuildResult{Status: BuildFailed, Error: "build failed"})
+
+		if summary.CacheHits != 1 {
+			t.Errorf("want 1 cache hit, got %d", summary.CacheHits)
+		}
+		if len(summary.Steps) != 2 || summary.Steps[1].Error != "exit code 2" {
+			t.Errorf("want failed step with error, got %+v", summary.Steps)
+		}
+		if diff := cmp.Diff([]string{"deprecated syntax"}, summary.Warnings); diff != "" {
+			t.Errorf("warnings mismatch (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff([]string{"exit code 2", "build failed"}, summary.Errors); diff != "" {
+			t.Errorf("errors mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
@@ -0,0 +1,270 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/openfaas/go-sdk/stack"
+)
+
+// DefaultStackConcurrency is the default number of functions of
+// a stack that are built at the same time.
+const DefaultStackConcurrency = 4
+
+// StackBuildOption is used to implement functional-style options that modify
+// the config used to build the functions of a stack.
+type StackBuildOption func(*StackBuildConfig)
+
+// StackBuildConfig is the config used to build the functions of a stack.
+type StackBuildConfig struct {
+	// Concurrency is the maximum number of functions that are built at the same time.
+	Concurrency int
+
+	// ContextOptions are applied when the build context of each function is created.
+	ContextOptions []BuildContextOption
+
+	// Log receives the build logs of all functions. Each line is
+	// prefixed with the name of the function it belongs to.
+	Log io.Writer
+}
+
+// WithConcurrency is an option to configure the maximum number of functions that are built
+// at the same time. If this option is not set DefaultStackConcurrency is used.
+func WithConcurrency(n int) StackBuildOption {
+	return func(c *StackBuildConfig) {
+		c.Concurrency = n
+	}
+}
+
+// WithStackContextOptions is an option to configure the options used to create the build
+// context of each function, i.e. WithTemplateDir and WithBuildDir.
+func WithStackContextOptions(options ...BuildContextOption) StackBuildOption {
+	return func(c *StackBuildConfig) {
+		c.ContextOptions = append(c.ContextOptions, options...)
+	}
+}
+
+// WithStackLog is an option to write the build logs of all functions to w while they are
+// built. Each line is prefixed with the name of the function, i.e. "[env] Step 1/5".
+func WithStackLog(w io.Writer) StackBuildOption {
+	return func(c *StackBuildConfig) {
+		c.Log = w
+	}
+}
+
+// BuildStack builds and pushes the images of all functions in the stack with the Function
+// Builder API. Functions with skip_build set are not built.
+//
+// For each function the language template is resolved from the template directory, the
+// build context is created from the handler and the copy paths of the stack configuration,
+// and the build args, build options, platforms and build secrets of the function are
+// applied. The packages of build options are added to the ADDITIONAL_PACKAGE build arg.
+// Build secrets are read from the files their values point to, and are sealed with the
+// key configured with WithBuildSecretsKey.
+//
+// Functions are built concurrently, up to the limit set with WithConcurrency. BuildStack
+// returns the result of each function that was built by name, including the full build
+// log. If any function fails to build, the error contains the errors of all functions
+// that failed. When ctx is cancelled, running builds are cancelled and functions that
+// were not started yet are not built.
+func (b *FunctionBuilder) BuildStack(ctx context.Context, services *stack.Services, options ...StackBuildOption) (map[string]BuildResult, error) {
+	c := &StackBuildConfig{
+		Concurrency: DefaultStackConcurrency,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if c.Concurrency < 1 {
+		c.Concurrency = 1
+	}
+
+	var log *prefixWriter
+	if c.Log != nil {
+		log = &prefixWriter{w: c.Log}
+	}
+
+	names := make([]string, 0, len(services.Functions))
+	for name, fn := range services.Functions {
+		if !fn.SkipBuild {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var (
+		wg      sync.WaitGroup
+		lock    sync.Mutex
+		results = make(map[string]BuildResult, len(names))
+		errs    []error
+		sem     = make(chan struct{}, c.Concurrency)
+	)
+
+	for _, name := range names {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			lock.Lock()
+			errs = append(errs, fmt.Errorf("function %s: %w", name, ctx.Err()))
+			lock.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(name string, fn stack.Function) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			fn.Name = name
+			result, err := b.buildStackFunction(ctx, fn, services.StackConfiguration, c, log)
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("function %s: %w", name, err))
+				return
+			}
+
+			results[name] = result
+			if result.Status == BuildFailed {
+				errs = append(errs, fmt.Errorf("function %s: build failed: %s", name, result.Error))
+			}
+		}(name, services.Functions[name])
+	}
+
+	wg.Wait()
+
+	return results, errors.Join(errs...)
+}
+
+// buildStackFunction creates the build context and tar archive for a function of a
+// stack and builds it. The build log is collected in the result and written to log.
+// The build request is cancelled when ctx is done.
+func (b *FunctionBuilder) buildStackFunction(ctx context.Context, fn stack.Function, config stack.StackConfiguration, c *StackBuildConfig, log *prefixWriter) (BuildResult, error) {
+	contextConfig := &BuildContextConfig{
+		BuildDir:    DefaultBuildDir,
+		TemplateDir: DefaultTemplateDir,
+	}
+	for _, option := range c.ContextOptions {
+		option(contextConfig)
+	}
+
+	language := strings.ToLower(fn.Language)
+
+	contextOptions := c.ContextOptions
+
+	var languageTemplate *stack.LanguageTemplate
+	if language != "dockerfile" {
+		var err error
+		templatePath := path.Join(contextConfig.TemplateDir, language, "template.yml")
+		languageTemplate, err = stack.ParseYAMLForLanguageTemplate(templatePath)
+		if err != nil {
+			return BuildResult{}, fmt.Errorf("unable to load template %s: %w", fn.Language, err)
+		}
+
+		if len(languageTemplate.HandlerFolder) > 0 {
+			contextOptions = append(contextOptions[:len(contextOptions):len(contextOptions)], WithHandlerOverlay(languageTemplate.HandlerFolder))
+		}
+	}
+
+	buildConfig := &BuildConfig{
+		Image:     fn.Image,
+		BuildArgs: maps.Clone(fn.BuildArgs),
+		Platforms: splitPlatforms(fn.Platforms),
+	}
+	if err := buildConfig.ApplyBuildOptions(languageTemplate, fn.BuildOptions); err != nil {
+		return BuildResult{}, err
+	}
+	if err := buildConfig.Validate(); err != nil {
+		return BuildResult{}, err
+	}
+
+	buildSecrets, err := readBuildSecrets(fn.BuildSecrets)
+	if err != nil {
+		return BuildResult{}, err
+	}
+
+	contextPath, err := CreateBuildContext(fn.Name, fn.Handler, language, config.CopyExtraPaths, contextOptions...)
+	if err != nil {
+		return BuildResult{}, err
+	}
+
+	tarFile, err := os.CreateTemp("", "openfaas-build-"+fn.Name+"-*.tar")
+	if err != nil {
+		return BuildResult{}, err
+	}
+	tarFile.Close()
+	defer os.Remove(tarFile.Name())
+
+	if err := MakeTar(tarFile.Name(), contextPath, buildConfig); err != nil {
+		return BuildResult{}, fmt.Errorf("unable to create build tar: %w", err)
+	}
+
+	stream, err := b.BuildWithSecretsStreamContext(ctx, tarFile.Name(), buildSecrets)
+	if err != nil {
+		return BuildResult{}, err
+	}
+	defer stream.Close()
+
+	return stream.collect(func(result BuildResult) {
+		if log != nil {
+			log.writeLines(fn.Name, result.Log)
+		}
+	})
+}
+
+// readBuildSecrets reads the value of each build secret from the file it points to.
+func readBuildSecrets(secrets map[string]string) (map[string]string, error) {
+	if len(secrets) == 0 {
+		return nil, nil
+	}
+
+	values := make(map[string]string, len(secrets))
+	for name, file := range secrets {
+		data, err := os.ReadFile(filepath.FromSlash(file))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read build secret %s: %w", name, err)
+		}
+		values[name] = string(data)
+	}
+
+	return values, nil
+}
+
+// splitPlatforms splits a comma separated list of platforms, i.e. "linux/amd64,linux/arm64".
+func splitPlatforms(platforms string) []string {
+	var result []string
+	for _, p := range strings.Split(platforms, ",") {
+		if p = strings.TrimSpace(p); len(p) > 0 {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// prefixWriter writes log lines of concurrent builds to w, prefixed
+// by the function name, without interleaving lines.
+type prefixWriter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (p *prefixWriter) writeLines(name string, lines []string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, line := range lines {
+		fmt.Fprintf(p.w, "[%s] %s\n", name, line)
+	}
+}
@@ -0,0 +1,219 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/openfaas/go-sdk/stack"
+)
+
+func Test_BuildStack(t *testing.T) {
+	var (
+		active    atomic.Int32
+		maxActive atomic.Int32
+
+		lock    sync.Mutex
+		configs = map[string]BuildConfig{}
+		files   = map[string]map[string]string{}
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			m := maxActive.Load()
+			if n <= m || maxActive.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("io.ReadAll returned error: %v", err)
+			return
+		}
+		tarFiles, err := readTarFiles(data)
+		if err != nil {
+			t.Errorf("readTarFiles returned error: %v", err)
+			return
+		}
+
+		var config BuildConfig
+		if err := json.Unmarshal([]byte(tarFiles[BuilderConfigFileName]), &config); err != nil {
+			t.Errorf("unable to decode build config: %v", err)
+			return
+		}
+
+		lock.Lock()
+		configs[config.Image] = config
+		files[config.Image] = tarFiles
+		lock.Unlock()
+
+		// Keep the build running so concurrent builds overlap.
+		time.Sleep(20 * time.Millisecond)
+
+		enc := json.NewEncoder(w)
+		enc.Encode(BuildResult{Log: []string{"building " + config.Image}, Status: BuildInProgress})
+		if strings.Contains(config.Image, "broken") {
+			enc.Encode(BuildResult{Status: BuildFailed, Error: "exit code 1"})
+			return
+		}
+		enc.Encode(BuildResult{Image: config.Image, Status: BuildSuccess})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	templateDir := filepath.Join(dir, "template")
+	writeTestFiles(t, templateDir, map[string]string{
+		"python3/template.yml": "language: python3\nhandler_folder: src\nbuild_options:\n  - name: dev\n    packages: [make, gcc]\n",
+		"python3/Dockerfile":   "FROM python:3\n",
+	})
+
+	functions := map[string]stack.Function{
+		"skipped": {Language: "dockerfile", Image: "skipped:latest", SkipBuild: true},
+	}
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("fn%d", i)
+		handler := filepath.Join(dir, name)
+		writeTestFiles(t, handler, map[string]string{"handler.py": name})
+
+		functions[name] = stack.Function{
+			Language:  "python3",
+			Handler:   handler,
+			Image:     name + ":latest",
+			BuildArgs: map[string]string{"NAME": name},
+			Platforms: "linux/amd64, linux/arm64",
+		}
+	}
+
+	fn3 := functions["fn3"]
+	fn3.BuildOptions = []string{"dev"}
+	functions["fn3"] = fn3
+
+	u, _ := url.Parse(server.URL)
+	b := NewFunctionBuilder(u, http.DefaultClient)
+
+	var log bytes.Buffer
+	results, err := b.BuildStack(t.Context(), &stack.Services{Functions: functions},
+		WithConcurrency(2),
+		WithStackLog(&log),
+		WithStackContextOptions(WithTemplateDir(templateDir), WithBuildDir(filepath.Join(dir, "build"))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 5 {
+		t.Fatalf("want 5 results, got %d", len(results))
+	}
+	if got := maxActive.Load(); got != 2 {
+		t.Fatalf("want 2 concurrent builds, got %d", got)
+	}
+
+	wantResult := BuildResult{
+		Log:    []string{"building fn3:latest"},
+		Image:  "fn3:latest",
+		Status: BuildSuccess,
+	}
+	if diff := cmp.Diff(wantResult, results["fn3"]); diff != "" {
+		t.Fatalf("build result mismatch (-want +got):\n%s", diff)
+	}
+
+	wantConfig := BuildConfig{
+		Image:     "fn3:latest",
+		BuildArgs: map[string]string{"NAME": "fn3", AdditionalPackageBuildArg: "make gcc"},
+		Platforms: []string{"linux/amd64", "linux/arm64"},
+	}
+	if diff := cmp.Diff(wantConfig, configs["fn3:latest"]); diff != "" {
+		t.Fatalf("build config mismatch (-want +got):\n%s", diff)
+	}
+	if got := files["fn3:latest"]["context/src/handler.py"]; got != "fn3" {
+		t.Fatalf("want handler in the handler folder of the template, got %q", got)
+	}
+
+	if !strings.Contains(log.String(), "[fn3] building fn3:latest\n") {
+		t.Fatalf("want log lines prefixed by function name, got:\n%s", log.String())
+	}
+	if _, ok := configs["skipped:latest"]; ok {
+		t.Fatal("want function with skip_build to be skipped")
+	}
+
+	t.Run("failed builds are reported", func(t *testing.T) {
+		broken := filepath.Join(dir, "broken")
+		writeTestFiles(t, broken, map[string]string{"Dockerfile": "FROM scratch\n"})
+
+		results, err := b.BuildStack(t.Context(), &stack.Services{Functions: map[string]stack.Function{
+			"broken":  {Language: "dockerfile", Handler: broken, Image: "broken:latest"},
+			"missing": {Language: "go", Handler: broken, Image: "missing:latest"},
+		}}, WithStackContextOptions(WithTemplateDir(templateDir), WithBuildDir(filepath.Join(dir, "build"))))
+		if err == nil {
+			t.Fatal("want error for failed builds")
+		}
+
+		if !strings.Contains(err.Error(), "function broken: build failed: exit code 1") {
+			t.Errorf("want build failure in error, got: %v", err)
+		}
+		if !strings.Contains(err.Error(), "function missing: unable to load template go") {
+			t.Errorf("want template error in error, got: %v", err)
+		}
+		if results["broken"].Status != BuildFailed {
+			t.Errorf("want failed result for broken function, got %+v", results["broken"])
+		}
+	})
+}
+
+func Test_BuildStack_Cancel(t *testing.T) {
+	started := make(chan struct{})
+	requestDone := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+
+		json.NewEncoder(w).Encode(BuildResult{Log: []string{"building"}, Status: BuildInProgress})
+		w.(http.Flusher).Flush()
+		close(started)
+
+		<-r.Context().Done()
+		close(requestDone)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	handler := filepath.Join(dir, "fn")
+	writeTestFiles(t, handler, map[string]string{"Dockerfile": "FROM scratch\n"})
+
+	u, _ := url.Parse(server.URL)
+	b := NewFunctionBuilder(u, http.DefaultClient)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	_, err := b.BuildStack(ctx, &stack.Services{Functions: map[string]stack.Function{
+		"fn": {Language: "dockerfile", Handler: handler, Image: "fn:latest"},
+	}}, WithStackContextOptions(WithBuildDir(filepath.Join(dir, "build"))))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("want context.Canceled, got: %v", err)
+	}
+
+	select {
+	case <-requestDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want running build to be cancelled")
+	}
+}
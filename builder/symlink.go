@@ -0,0 +1,202 @@
+package builder
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkPolicy controls how symbolic links in a build context are handled. Links
+// must always resolve to a path within the build context, links that point outside
+// of it or that can not be resolved are rejected with an error.
+type SymlinkPolicy int
+
+const (
+	// SymlinkPreserve adds symbolic links as links. The link target is rewritten
+	// relative to the link, so absolute links keep working in the build context.
+	SymlinkPreserve SymlinkPolicy = iota
+
+	// SymlinkFollow replaces symbolic links with a copy of the file
+	// or directory they point to.
+	SymlinkFollow
+)
+
+func (p SymlinkPolicy) String() string {
+	switch p {
+	case SymlinkPreserve:
+		return "preserve"
+	case SymlinkFollow:
+		return "follow"
+	default:
+		return fmt.Sprintf("SymlinkPolicy(%d)", int(p))
+	}
+}
+
+// contextWalker walks a directory tree on disk. Paths excluded by the patterns are
+// skipped, symbolic links are handled according to the symlink policy and special
+// files such as sockets, devices and named pipes are skipped.
+type contextWalker struct {
+	// root is the resolved absolute path symbolic links must resolve within.
+	root     string
+	excludes *excludeMatcher
+	symlinks SymlinkPolicy
+}
+
+// walkFunc is called for each entry of the tree. src is the path the content is read
+// from, name is the slash separated path relative to the start of the walk, "." for
+// the start itself. linkname is set to the slash separated link target relative to the
+// link if the entry is a preserved symbolic link.
+type walkFunc func(src, name string, info fs.FileInfo, linkname string) error
+
+func newContextWalker(root string, excludes *excludeMatcher, symlinks SymlinkPolicy) (*contextWalker, error) {
+	realRoot, err := realPath(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return &contextWalker{
+		root:     realRoot,
+		excludes: excludes,
+		symlinks: symlinks,
+	}, nil
+}
+
+// walk walks the tree at src and calls fn for each entry. relPath is the slash separated
+// path of src relative to the root that is matched against the exclude patterns, "." if
+// src is the root. The root itself is always followed if it is a symbolic link.
+func (w *contextWalker) walk(src, relPath string, fn walkFunc) error {
+	if relPath == "." {
+		info, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		return w.walkPath(src, w.root, relPath, ".", info, nil, fn)
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	realDir, err := realPath(filepath.Dir(src))
+	if err != nil {
+		return err
+	}
+
+	return w.walkPath(src, filepath.Join(realDir, filepath.Base(src)), relPath, ".", info, nil, fn)
+}
+
+// walkPath walks the entry at src. realSrc is the location of src with all symbolic
+// links of its parent directories resolved and ancestors are the resolved paths of the
+// directories that are being walked, used to detect symbolic link loops.
+func (w *contextWalker) walkPath(src, realSrc, relPath, name string, info fs.FileInfo, ancestors []string, fn walkFunc) error {
+	excluded := relPath != "." && w.excludes.excluded(relPath)
+	if excluded && (!info.IsDir() || w.excludes.skipDir(relPath)) {
+		debugPrint(fmt.Sprintf("Skipping excluded path: %s", src))
+		return nil
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := w.resolve(src)
+		if err != nil {
+			return err
+		}
+
+		if w.symlinks == SymlinkPreserve {
+			linkname, err := filepath.Rel(filepath.Dir(realSrc), target)
+			if err != nil {
+				return err
+			}
+			return fn(src, name, info, filepath.ToSlash(linkname))
+		}
+
+		for _, ancestor := range ancestors {
+			if ancestor == target || strings.HasPrefix(ancestor, target+string(filepath.Separator)) {
+				return fmt.Errorf("symlink loop detected: %s points to %s", src, target)
+			}
+		}
+
+		if info, err = os.Stat(target); err != nil {
+			return err
+		}
+		src, realSrc = target, target
+	}
+
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		debugPrint(fmt.Sprintf("Skipping special file: %s (%s)", src, info.Mode().Type()))
+		return nil
+	}
+
+	// The directory of an excluded path is not added, only
+	// the paths in it that are re-included by an exception.
+	if !excluded {
+		if err := fn(src, name, info, ""); err != nil {
+			return err
+		}
+	}
+
+	if !info.IsDir() {
+		return nil
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	ancestors = append(ancestors, realSrc)
+	for _, entry := range entries {
+		childInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if err := w.walkPath(
+			filepath.Join(src, entry.Name()),
+			filepath.Join(realSrc, entry.Name()),
+			joinRelPath(relPath, entry.Name()),
+			joinRelPath(name, entry.Name()),
+			childInfo,
+			ancestors,
+			fn,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolve returns the resolved absolute target of the symbolic link at src
+// and ensures it is located within the root.
+func (w *contextWalker) resolve(src string) (string, error) {
+	target, err := realPath(src)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve symlink %s: %w", src, err)
+	}
+
+	rel, err := filepath.Rel(w.root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("forbidden symlink %s points outside of the build context: %s", src, target)
+	}
+
+	return target, nil
+}
+
+// realPath returns the absolute path of p with all symbolic links resolved.
+func realPath(p string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(resolved)
+}
+
+func joinRelPath(dir, name string) string {
+	if dir == "." {
+		return name
+	}
+	return dir + "/" + name
+}
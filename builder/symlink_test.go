@@ -0,0 +1,290 @@
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// writeSymlinkTree writes a build context with symbolic links to a
+// file, a directory, an absolute path and a unix socket.
+func writeSymlinkTree(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"Dockerfile":  "FROM scratch\n",
+		"lib/util.py": "def util():\n    pass\n",
+	})
+
+	symlink(t, filepath.Join("lib", "util.py"), filepath.Join(dir, "util.py"))
+	symlink(t, "lib", filepath.Join(dir, "shared"))
+	symlink(t, filepath.Join(dir, "lib", "util.py"), filepath.Join(dir, "lib", "abs.py"))
+
+	l, err := net.Listen("unix", filepath.Join(dir, "app.sock"))
+	if err != nil {
+		t.Skipf("unix sockets are not supported: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	return dir
+}
+
+func Test_MakeTar_Symlinks(t *testing.T) {
+	dir := writeSymlinkTree(t)
+
+	t.Run("links are preserved by default", func(t *testing.T) {
+		headers := makeTestTar(t, dir)
+
+		want := map[string]string{
+			"context":             "",
+			"context/Dockerfile":  "",
+			"context/lib":         "",
+			"context/lib/abs.py":  "util.py",
+			"context/lib/util.py": "",
+			"context/shared":      "lib",
+			"context/util.py":     "lib/util.py",
+			BuilderConfigFileName: "",
+		}
+		if diff := cmp.Diff(want, headers); diff != "" {
+			t.Fatalf("tar entries mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("links are followed", func(t *testing.T) {
+		tarPath := filepath.Join(t.TempDir(), "build.tar")
+		if err := MakeTar(tarPath, dir, &BuildConfig{Image: "test"}, WithSymlinkPolicy(SymlinkFollow)); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(tarPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := readTarFiles(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"context/util.py", "context/shared/util.py", "context/lib/abs.py"} {
+			if files[name] != "def util():\n    pass\n" {
+				t.Errorf("want content of lib/util.py for %s, got %q", name, files[name])
+			}
+		}
+		if _, ok := files["context/app.sock"]; ok {
+			t.Error("want socket to be skipped")
+		}
+	})
+}
+
+func Test_MakeTar_RejectsSymlinksOutsideContext(t *testing.T) {
+	outside := t.TempDir()
+	writeTestFiles(t, outside, map[string]string{"secret.txt": "secret"})
+
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{name: "relative link", target: filepath.Join("..", filepath.Base(outside), "secret.txt")},
+		{name: "absolute link", target: filepath.Join(outside, "secret.txt")},
+		{name: "directory link", target: outside},
+		{name: "dangling link", target: "missing.txt"},
+	}
+
+	for _, test := range tests {
+		for _, policy := range []SymlinkPolicy{SymlinkPreserve, SymlinkFollow} {
+			t.Run(test.name+" "+policy.String(), func(t *testing.T) {
+				parent := filepath.Dir(outside)
+				dir, err := os.MkdirTemp(parent, "context-")
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { os.RemoveAll(dir) })
+
+				writeTestFiles(t, dir, map[string]string{"Dockerfile": "FROM scratch\n"})
+				symlink(t, test.target, filepath.Join(dir, "link"))
+
+				tarPath := filepath.Join(t.TempDir(), "build.tar")
+				err = MakeTar(tarPath, dir, &BuildConfig{Image: "test"}, WithSymlinkPolicy(policy))
+				if err == nil {
+					t.Fatal("want error for link that does not resolve within the build context")
+				}
+				if !strings.Contains(err.Error(), "outside of the build context") && !strings.Contains(err.Error(), "unable to resolve symlink") {
+					t.Fatalf("want symlink error, got: %v", err)
+				}
+			})
+		}
+	}
+
+	t.Run("excluded links are not resolved", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFiles(t, dir, map[string]string{
+			"Dockerfile":    "FROM scratch\n",
+			".dockerignore": "link\n",
+		})
+		symlink(t, filepath.Join(outside, "secret.txt"), filepath.Join(dir, "link"))
+
+		tarPath := filepath.Join(t.TempDir(), "build.tar")
+		if err := MakeTar(tarPath, dir, &BuildConfig{Image: "test"}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func Test_MakeTar_SymlinkLoop(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"Dockerfile":   "FROM scratch\n",
+		"a/b/index.js": "",
+	})
+	symlink(t, filepath.Join("..", ".."), filepath.Join(dir, "a", "b", "loop"))
+
+	tarPath := filepath.Join(t.TempDir(), "build.tar")
+	err := MakeTar(tarPath, dir, &BuildConfig{Image: "test"}, WithSymlinkPolicy(SymlinkFollow))
+	if err == nil || !strings.Contains(err.Error(), "symlink loop") {
+		t.Fatalf("want symlink loop error, got: %v", err)
+	}
+
+	// A preserved link to a parent directory is valid.
+	if err := MakeTar(tarPath, dir, &BuildConfig{Image: "test"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_CreateBuildContext_Symlinks(t *testing.T) {
+	handler := writeSymlinkTree(t)
+	buildDir := t.TempDir()
+
+	t.Run("links are followed by default", func(t *testing.T) {
+		contextPath, err := CreateBuildContext("fn", handler, "dockerfile", nil, WithBuildDir(buildDir))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := os.Lstat(filepath.Join(contextPath, "shared", "util.py"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.Mode().IsRegular() {
+			t.Fatalf("want regular file, got mode %s", info.Mode())
+		}
+		if _, err := os.Lstat(filepath.Join(contextPath, "app.sock")); !os.IsNotExist(err) {
+			t.Fatalf("want socket to be skipped, got: %v", err)
+		}
+	})
+
+	t.Run("links are preserved", func(t *testing.T) {
+		contextPath, err := CreateBuildContext("fn", handler, "dockerfile", nil, WithBuildDir(buildDir), WithContextSymlinkPolicy(SymlinkPreserve))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for link, want := range map[string]string{
+			"shared":     "lib",
+			"util.py":    filepath.Join("lib", "util.py"),
+			"lib/abs.py": "util.py",
+		} {
+			got, err := os.Readlink(filepath.Join(contextPath, filepath.FromSlash(link)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("want link %s to point to %s, got %s", link, want, got)
+			}
+		}
+
+		data, err := os.ReadFile(filepath.Join(contextPath, "shared", "util.py"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "def util():\n    pass\n" {
+			t.Fatalf("want link to resolve in the build context, got %q", string(data))
+		}
+	})
+}
+
+func Test_CreateBuildContext_SharedHandlerCode(t *testing.T) {
+	project := t.TempDir()
+	writeTestFiles(t, project, map[string]string{
+		"fn/handler.py":      "import common\n",
+		"common/__init__.py": "SHARED = True\n",
+	})
+	symlink(t, filepath.Join("..", "common"), filepath.Join(project, "fn", "common"))
+	t.Chdir(project)
+
+	contextPath, err := CreateBuildContext("fn", "fn", "dockerfile", nil, WithBuildDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(contextPath, "common", "__init__.py"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "SHARED = True\n" {
+		t.Fatalf("want shared code in the build context, got %q", string(data))
+	}
+
+	t.Run("links outside of the project are rejected", func(t *testing.T) {
+		outside := t.TempDir()
+		writeTestFiles(t, outside, map[string]string{"secret": "secret"})
+		symlink(t, filepath.Join(outside, "secret"), filepath.Join(project, "fn", "secret"))
+		defer os.Remove(filepath.Join(project, "fn", "secret"))
+
+		_, err := CreateBuildContext("fn", "fn", "dockerfile", nil, WithBuildDir(t.TempDir()))
+		if err == nil || !strings.Contains(err.Error(), "forbidden symlink") {
+			t.Fatalf("want forbidden symlink error, got: %v", err)
+		}
+	})
+
+	t.Run("preserved links must resolve within the handler", func(t *testing.T) {
+		_, err := CreateBuildContext("fn", "fn", "dockerfile", nil, WithBuildDir(t.TempDir()), WithContextSymlinkPolicy(SymlinkPreserve))
+		if err == nil || !strings.Contains(err.Error(), "forbidden symlink") {
+			t.Fatalf("want forbidden symlink error, got: %v", err)
+		}
+	})
+}
+
+// makeTestTar creates a tar archive of the build context and returns
+// the link target of each entry by name.
+func makeTestTar(t *testing.T, dir string, options ...TarOption) map[string]string {
+	t.Helper()
+
+	tarPath := filepath.Join(t.TempDir(), "build.tar")
+	if err := MakeTar(tarPath, dir, &BuildConfig{Image: "test"}, options...); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := map[string]string{}
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers[header.Name] = header.Linkname
+	}
+
+	return headers
+}
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+}
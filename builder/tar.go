@@ -0,0 +1,481 @@
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// WriteTar writes a tar archive that contains the build config and the build
+// context read from fsys to w. The archive has the same layout as the archive
+// created by MakeTar, so no files have to be written to disk, i.e. when the
+// build context is generated in memory with fstest.MapFS or embedded with embed.FS.
+//
+// Symbolic links in fsys are not included. An error is returned if a symlink policy
+// other than SymlinkPreserve is set, as links can not be resolved within an fs.FS.
+func WriteTar(w io.Writer, context fs.FS, buildConfig *BuildConfig, options ...TarOption) error {
+	if err := buildConfig.Validate(); err != nil {
+		return err
+	}
+
+	c, err := newFSTarConfig(options)
+	if err != nil {
+		return err
+	}
+
+	excludes, err := loadExcludeMatcher(context, c.ExcludePatterns)
+	if err != nil {
+		return err
+	}
+
+	return writeBuildTar(w, buildConfig, nil, func(tw *tar.Writer) error {
+		return writeFSContext(tw, context, excludes, c.Deterministic)
+	})
+}
+
+// ContextDigestFS is like ContextDigest but reads the build context from fsys.
+// The digest is equal to the digest of the archive written by WriteTar with
+// the WithDeterministic option.
+func ContextDigestFS(context fs.FS, buildConfig *BuildConfig, options ...TarOption) (string, error) {
+	h := sha256.New()
+	if err := WriteTar(h, context, buildConfig, append(options, WithDeterministic())...); err != nil {
+		return "", err
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// newFSTarConfig applies the options for a build context read from an fs.FS. Symbolic
+// links can not be resolved within an fs.FS, so only the default policy is accepted.
+func newFSTarConfig(options []TarOption) (*TarConfig, error) {
+	c := newTarConfig(options)
+	if c.Symlinks != SymlinkPreserve {
+		return nil, fmt.Errorf("symlink policy %s is not supported for an fs.FS build context, symbolic links in fsys are not included", c.Symlinks)
+	}
+
+	return c, nil
+}
+
+// writeBuildTar writes a build tar archive to w. The build context is written by
+// writeContext, followed by the build config and the sealed build secrets if set.
+func writeBuildTar(w io.Writer, buildConfig *BuildConfig, sealedSecrets []byte, writeContext func(tw *tar.Writer) error) error {
+	tw := tar.NewWriter(w)
+
+	if err := writeContext(tw); err != nil {
+		return err
+	}
+
+	configBytes, err := json.Marshal(buildConfig)
+	if err != nil {
+		return err
+	}
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name: BuilderConfigFileName,
+		Mode: 0664,
+		Size: int64(len(configBytes)),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(configBytes); err != nil {
+		return err
+	}
+
+	if sealedSecrets != nil {
+		if err := tw.WriteHeader(&tar.Header{
+			Name: BuildSecretsFileName,
+			Mode: 0600,
+			Size: int64(len(sealedSecrets)),
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(sealedSecrets); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// writeFSContext writes the files in fsys to the context folder of the tar archive.
+// Only regular files and directories that are not excluded are included.
+func writeFSContext(tw *tar.Writer, fsys fs.FS, excludes *excludeMatcher, deterministic bool) error {
+	return fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+
+		if p != "." && excludes.excluded(p) {
+			if d.IsDir() && excludes.skipDir(p) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join("context", p)
+		if deterministic {
+			normalizeHeader(header)
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		f, err := fsys.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// tarContextEntry is an entry of a build context read from a tar archive.
+type tarContextEntry struct {
+	header *tar.Header
+	data   []byte
+}
+
+// tarContext is a build context read from a tar archive. The archive is read into
+// memory, as the targets of symbolic links can appear anywhere in the archive.
+type tarContext struct {
+	entries  map[string]*tarContextEntry
+	names    []string
+	excludes *excludeMatcher
+	config   *TarConfig
+}
+
+// writeTarContext copies the entries of the tar archive read from r to the context folder
+// of the build tar archive. Entries excluded by the .dockerignore file in the archive or by
+// the exclude patterns of c are skipped, as are sockets, devices and named pipes. Symbolic
+// links that resolve outside of the build context are rejected.
+func writeTarContext(tw *tar.Writer, r io.Reader, c *TarConfig) error {
+	t := &tarContext{
+		entries: map[string]*tarContextEntry{},
+		config:  c,
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read build context: %w", err)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("unable to read build context: %w", err)
+		}
+
+		name := tarEntryName(header.Name)
+		if _, ok := t.entries[name]; !ok {
+			t.names = append(t.names, name)
+		}
+		t.entries[name] = &tarContextEntry{header: header, data: data}
+	}
+
+	if c.Deterministic {
+		sort.Strings(t.names)
+	}
+
+	var patterns []string
+	if e, ok := t.entries[DockerignoreFileName]; ok {
+		var err error
+		if patterns, err = readExcludePatterns(bytes.NewReader(e.data)); err != nil {
+			return fmt.Errorf("unable to read %s: %w", DockerignoreFileName, err)
+		}
+	}
+
+	excludes, err := newContextExcludeMatcher(patterns, c.ExcludePatterns)
+	if err != nil {
+		return err
+	}
+	t.excludes = excludes
+
+	for _, name := range t.names {
+		if err := t.writeEntry(tw, name, t.entries[name], 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// maxSymlinkDepth limits how many symbolic links are followed for
+// a single entry, to detect loops.
+const maxSymlinkDepth = 40
+
+// writeEntry writes the entry e with the given name to the context folder of the
+// build tar archive. With the SymlinkFollow policy, symbolic links are replaced by
+// their target, which is written with the name of the link.
+func (t *tarContext) writeEntry(tw *tar.Writer, name string, e *tarContextEntry, depth int) error {
+	if name != "." && t.excludes.excluded(name) {
+		debugPrint(fmt.Sprintf("Skipping excluded path: %s", name))
+		return nil
+	}
+
+	header := *e.header
+	header.Name = path.Join("context", name)
+	if header.Typeflag == tar.TypeDir {
+		header.Name += "/"
+	}
+
+	switch header.Typeflag {
+	case tar.TypeReg, tar.TypeDir:
+	case tar.TypeLink:
+		header.Linkname = path.Join("context", tarEntryName(header.Linkname))
+	case tar.TypeSymlink:
+		target, err := resolveTarSymlink(name, header.Linkname)
+		if err != nil {
+			return err
+		}
+		if t.config.Symlinks == SymlinkFollow {
+			return t.writeSymlinkTarget(tw, name, target, depth)
+		}
+	default:
+		debugPrint(fmt.Sprintf("Skipping special file: %s (type %q)", name, header.Typeflag))
+		return nil
+	}
+
+	if t.config.Deterministic {
+		normalizeHeader(&header)
+	}
+
+	if err := tw.WriteHeader(&header); err != nil {
+		return err
+	}
+	_, err := tw.Write(e.data)
+	return err
+}
+
+// writeSymlinkTarget writes the target of the symbolic link with the given name. All
+// entries in a target directory are written to the directory with the name of the link.
+func (t *tarContext) writeSymlinkTarget(tw *tar.Writer, name, target string, depth int) error {
+	if depth >= maxSymlinkDepth {
+		return fmt.Errorf("symlink loop detected: %s points to %s", name, target)
+	}
+
+	e, ok := t.entries[target]
+	if !ok && t.hasChildren(target) {
+		// Archives do not always have entries for directories.
+		e = &tarContextEntry{header: &tar.Header{Typeflag: tar.TypeDir, Mode: 0755}}
+	} else if !ok {
+		return fmt.Errorf("unable to resolve symlink %s: %s does not exist in the build context", name, target)
+	}
+
+	if err := t.writeEntry(tw, name, e, depth+1); err != nil {
+		return err
+	}
+
+	if e.header.Typeflag != tar.TypeDir {
+		return nil
+	}
+
+	for _, child := range t.names {
+		rel, ok := strings.CutPrefix(child, target+"/")
+		if target == "." {
+			rel, ok = child, child != "."
+		}
+		if !ok {
+			continue
+		}
+		if err := t.writeEntry(tw, path.Join(name, rel), t.entries[child], depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasChildren reports whether the archive has entries in the directory dir.
+func (t *tarContext) hasChildren(dir string) bool {
+	if dir == "." {
+		return len(t.names) > 0
+	}
+	for _, name := range t.names {
+		if strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTarSymlink returns the path of the target of a symbolic link in the build context
+// relative to its root. Links with an absolute target or a target outside of the build
+// context are rejected.
+func resolveTarSymlink(name, linkname string) (string, error) {
+	if path.IsAbs(linkname) {
+		return "", fmt.Errorf("forbidden symlink %s points outside of the build context: %s", name, linkname)
+	}
+
+	target := path.Join(path.Dir(name), linkname)
+	if target == ".." || strings.HasPrefix(target, "../") {
+		return "", fmt.Errorf("forbidden symlink %s points outside of the build context: %s", name, linkname)
+	}
+
+	return target, nil
+}
+
+// tarEntryName returns the cleaned name of a tar entry relative to the root of the
+// build context. Leading "/" and "../" elements are removed.
+func tarEntryName(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if len(name) == 0 {
+		return "."
+	}
+	return name
+}
+
+// BuildFromFS builds and pushes a function image with the build context read from
+// fsys and the build config. Files excluded by the .dockerignore file of the build
+// context are not sent. The build tar archive is streamed to the builder API
+// without writing it to disk. Build secrets are sealed and added to the archive
+// if buildSecrets is not empty.
+//
+// The options are applied like with WriteTar, i.e. WithExcludePatterns and
+// WithDeterministic. Symbolic links in fsys are not included, an error is returned
+// if a symlink policy other than SymlinkPreserve is set.
+func (b *FunctionBuilder) BuildFromFS(fsys fs.FS, buildConfig *BuildConfig, buildSecrets map[string]string, options ...TarOption) (BuildResult, error) {
+	res, err := b.buildFromFS(context.Background(), fsys, buildConfig, buildSecrets, buildModeResult, options)
+	if err != nil {
+		return BuildResult{}, err
+	}
+
+	return parseBuildResult(res)
+}
+
+// BuildFromFSWithStream is like BuildFromFS but returns a stream of build results.
+func (b *FunctionBuilder) BuildFromFSWithStream(fsys fs.FS, buildConfig *BuildConfig, buildSecrets map[string]string, options ...TarOption) (*BuildResultStream, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	res, err := b.buildFromFS(ctx, fsys, buildConfig, buildSecrets, buildModeStream, options)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return newBuildResultStream(ctx, cancel, res)
+}
+
+// BuildFromReader builds and pushes a function image with the build context read from r
+// as a tar archive, like `docker build - < context.tar`, and the build config. The build
+// tar archive is created in memory. Build secrets are sealed and added to the archive if
+// buildSecrets is not empty.
+//
+// Entries excluded by a .dockerignore file in the archive or by WithExcludePatterns are
+// not sent. Symbolic links that resolve outside of the build context are rejected, and
+// are replaced by their target with the SymlinkFollow policy. Sockets, devices and named
+// pipes are skipped.
+func (b *FunctionBuilder) BuildFromReader(r io.Reader, buildConfig *BuildConfig, buildSecrets map[string]string, options ...TarOption) (BuildResult, error) {
+	res, err := b.buildFromReader(context.Background(), r, buildConfig, buildSecrets, buildModeResult, options)
+	if err != nil {
+		return BuildResult{}, err
+	}
+
+	return parseBuildResult(res)
+}
+
+// BuildFromReaderWithStream is like BuildFromReader but returns a stream of build results.
+func (b *FunctionBuilder) BuildFromReaderWithStream(r io.Reader, buildConfig *BuildConfig, buildSecrets map[string]string, options ...TarOption) (*BuildResultStream, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	res, err := b.buildFromReader(ctx, r, buildConfig, buildSecrets, buildModeStream, options)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return newBuildResultStream(ctx, cancel, res)
+}
+
+func (b *FunctionBuilder) buildFromFS(ctx context.Context, fsys fs.FS, buildConfig *BuildConfig, buildSecrets map[string]string, mode buildMode, options []TarOption) (*http.Response, error) {
+	if b.buildSecretsErr != nil {
+		return nil, b.buildSecretsErr
+	}
+
+	if err := buildConfig.Validate(); err != nil {
+		return nil, err
+	}
+
+	sealedSecrets, err := b.sealSecrets(buildSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newFSTarConfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	excludes, err := loadExcludeMatcher(fsys, c.ExcludePatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.send(ctx, func(w io.Writer) error {
+		return writeBuildTar(w, buildConfig, sealedSecrets, func(tw *tar.Writer) error {
+			return writeFSContext(tw, fsys, excludes, c.Deterministic)
+		})
+	}, mode)
+}
+
+func (b *FunctionBuilder) buildFromReader(ctx context.Context, r io.Reader, buildConfig *BuildConfig, buildSecrets map[string]string, mode buildMode, options []TarOption) (*http.Response, error) {
+	if b.buildSecretsErr != nil {
+		return nil, b.buildSecretsErr
+	}
+
+	if err := buildConfig.Validate(); err != nil {
+		return nil, err
+	}
+
+	sealedSecrets, err := b.sealSecrets(buildSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	// The reader can only be consumed once, the archive is kept
+	// in memory so it can be signed and sent.
+	var buf bytes.Buffer
+	if err := writeBuildTar(&buf, buildConfig, sealedSecrets, func(tw *tar.Writer) error {
+		return writeTarContext(tw, r, newTarConfig(options))
+	}); err != nil {
+		return nil, err
+	}
+
+	return b.send(ctx, func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	}, mode)
+}
@@ -0,0 +1,422 @@
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	hmac "github.com/alexellis/hmac/v2"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_WriteTar(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Dockerfile":          {Data: []byte("FROM scratch\n"), Mode: 0644},
+		"function/handler.py": {Data: []byte("def handle(req):\n    return req\n"), Mode: 0644},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTar(&buf, fsys, &BuildConfig{Image: "ttl.sh/test:latest"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readTarFiles(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"context":                     "",
+		"context/Dockerfile":          "FROM scratch\n",
+		"context/function":            "",
+		"context/function/handler.py": "def handle(req):\n    return req\n",
+		BuilderConfigFileName:         `{"image":"ttl.sh/test:latest"}`,
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("tar contents mismatch (-want +got):\n%s", diff)
+	}
+
+	t.Run("unsupported symlink policy", func(t *testing.T) {
+		err := WriteTar(io.Discard, fsys, &BuildConfig{Image: "ttl.sh/test:latest"}, WithSymlinkPolicy(SymlinkFollow))
+		if err == nil || !strings.Contains(err.Error(), "not supported") {
+			t.Fatalf("want unsupported symlink policy error, got: %v", err)
+		}
+	})
+}
+
+func Test_BuildFromFSAndReader(t *testing.T) {
+	want := map[string]string{
+		"context/Dockerfile":  "FROM scratch\n",
+		BuilderConfigFileName: `{"image":"ttl.sh/test:latest"}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("io.ReadAll returned error: %v", err)
+			return
+		}
+
+		wantDigest := hmac.Sign(body, []byte("payload-secret"), sha256.New)
+		if got := r.Header.Get("X-Build-Signature"); got != "sha256="+hex.EncodeToString(wantDigest) {
+			t.Errorf("unexpected signature: %s", got)
+		}
+
+		got, err := readTarFiles(body)
+		if err != nil {
+			t.Errorf("unable to read tar: %v", err)
+			return
+		}
+		for name, content := range want {
+			if got[name] != content {
+				t.Errorf("want %s with content %q, got %q", name, content, got[name])
+			}
+		}
+
+		io.WriteString(w, `{"status":"success","image":"ttl.sh/test:latest"}`)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	b := NewFunctionBuilder(serverURL, http.DefaultClient, WithHmacAuth("payload-secret"))
+	config := &BuildConfig{Image: "ttl.sh/test:latest"}
+
+	t.Run("fs.FS build context", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"Dockerfile": {Data: []byte("FROM scratch\n"), Mode: 0644},
+		}
+
+		result, err := b.BuildFromFS(fsys, config, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Status != BuildSuccess {
+			t.Fatalf("want status %q, got %q", BuildSuccess, result.Status)
+		}
+	})
+
+	t.Run("fs.FS build context with unsupported symlink policy", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"Dockerfile": {Data: []byte("FROM scratch\n"), Mode: 0644},
+		}
+
+		if _, err := b.BuildFromFS(fsys, config, nil, WithSymlinkPolicy(SymlinkFollow)); err == nil {
+			t.Fatal("want error for unsupported symlink policy")
+		}
+	})
+
+	t.Run("tar build context from reader", func(t *testing.T) {
+		var context bytes.Buffer
+		tw := tar.NewWriter(&context)
+		data := []byte("FROM scratch\n")
+		tw.WriteHeader(&tar.Header{Name: "./Dockerfile", Mode: 0644, Size: int64(len(data))})
+		tw.Write(data)
+		tw.Close()
+
+		result, err := b.BuildFromReader(&context, config, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Status != BuildSuccess {
+			t.Fatalf("want status %q, got %q", BuildSuccess, result.Status)
+		}
+	})
+
+	t.Run("invalid tar build context", func(t *testing.T) {
+		if _, err := b.BuildFromReader(bytes.NewReader([]byte("not a tar archive")), config, nil); err == nil {
+			t.Fatal("want error for invalid build context")
+		}
+	})
+}
+
+func Test_MakeTar_Deterministic(t *testing.T) {
+	files := map[string]string{
+		"Dockerfile":          "FROM scratch\n",
+		"function/handler.py": "def handle(req):\n    return req\n",
+		"function/run.sh":     "#!/bin/sh\n",
+	}
+
+	dir1 := t.TempDir()
+	writeTestFiles(t, dir1, files)
+	if err := os.Chmod(filepath.Join(dir1, "function", "run.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second tree has other timestamps and permissions.
+	dir2 := t.TempDir()
+	writeTestFiles(t, dir2, files)
+	if err := os.Chmod(filepath.Join(dir2, "function", "run.sh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir2, "Dockerfile"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-24 * time.Hour)
+	for name := range files {
+		if err := os.Chtimes(filepath.Join(dir2, filepath.FromSlash(name)), past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buildConfig := &BuildConfig{Image: "ttl.sh/test:latest"}
+
+	makeTar := func(dir string) []byte {
+		tarPath := filepath.Join(t.TempDir(), "build.tar")
+		if err := MakeTar(tarPath, dir, buildConfig, WithDeterministic()); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(tarPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	tar1 := makeTar(dir1)
+	tar2 := makeTar(dir2)
+	if !bytes.Equal(tar1, tar2) {
+		t.Fatal("want identical archives for identical build contexts")
+	}
+
+	tr := tar.NewReader(bytes.NewReader(tar1))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(header.Name, "context") {
+			continue
+		}
+
+		if header.ModTime.Unix() != 0 || header.Uid != 0 || header.Gid != 0 || len(header.Uname) > 0 || len(header.Gname) > 0 {
+			t.Errorf("%s: want timestamps and ownership to be cleared, got %+v", header.Name, header)
+		}
+
+		wantMode := int64(0644)
+		if header.Typeflag == tar.TypeDir || header.Name == "context/function/run.sh" {
+			wantMode = 0755
+		}
+		if header.Mode != wantMode {
+			t.Errorf("%s: want mode %o, got %o", header.Name, wantMode, header.Mode)
+		}
+	}
+
+	sum := sha256.Sum256(tar1)
+	wantDigest := "sha256:" + hex.EncodeToString(sum[:])
+
+	digest, err := ContextDigest(dir2, buildConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != wantDigest {
+		t.Fatalf("want digest %s, got %s", wantDigest, digest)
+	}
+
+	fsDigest, err := ContextDigestFS(fstest.MapFS{
+		"Dockerfile":          {Data: []byte(files["Dockerfile"]), Mode: 0644},
+		"function/handler.py": {Data: []byte(files["function/handler.py"]), Mode: 0644},
+		"function/run.sh":     {Data: []byte(files["function/run.sh"]), Mode: 0755},
+	}, buildConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsDigest != wantDigest {
+		t.Fatalf("want digest %s for fs.FS build context, got %s", wantDigest, fsDigest)
+	}
+
+	writeTestFiles(t, dir2, map[string]string{"function/handler.py": "def handle(req):\n    return None\n"})
+	changed, err := ContextDigest(dir2, buildConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed == digest {
+		t.Fatal("want digest to change when a file changes")
+	}
+}
+
+func Test_writeTarContext(t *testing.T) {
+	type entry struct {
+		name     string
+		typeflag byte
+		data     string
+		linkname string
+	}
+
+	makeArchive := func(entries ...entry) *bytes.Buffer {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, e := range entries {
+			tw.WriteHeader(&tar.Header{
+				Name:     e.name,
+				Typeflag: e.typeflag,
+				Linkname: e.linkname,
+				Mode:     0644,
+				Size:     int64(len(e.data)),
+			})
+			tw.Write([]byte(e.data))
+		}
+		tw.Close()
+		return &buf
+	}
+
+	writeContext := func(r io.Reader, options ...TarOption) (map[string]*tar.Header, map[string]string, error) {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		if err := writeTarContext(tw, r, newTarConfig(options)); err != nil {
+			return nil, nil, err
+		}
+		tw.Close()
+
+		headers := map[string]*tar.Header{}
+		tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			headers[hdr.Name] = hdr
+		}
+
+		files, err := readTarFiles(buf.Bytes())
+		return headers, files, err
+	}
+
+	t.Run("excluded entries are skipped", func(t *testing.T) {
+		archive := makeArchive(
+			entry{name: "Dockerfile", data: "FROM scratch\n"},
+			entry{name: ".dockerignore", data: "*.md\n"},
+			entry{name: "README.md", data: "readme"},
+			entry{name: "secret.txt", data: "secret"},
+			entry{name: "pipe", typeflag: tar.TypeFifo},
+		)
+
+		_, files, err := writeContext(archive, WithExcludePatterns("secret.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"context/.dockerignore", "context/Dockerfile"}
+		if diff := cmp.Diff(want, sortedKeys(files)); diff != "" {
+			t.Fatalf("entries mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("symlinks outside of the build context are rejected", func(t *testing.T) {
+		for _, linkname := range []string{"/etc/passwd", "../../etc/passwd", "sub/../../outside"} {
+			for _, policy := range []SymlinkPolicy{SymlinkPreserve, SymlinkFollow} {
+				archive := makeArchive(entry{name: "link", typeflag: tar.TypeSymlink, linkname: linkname})
+				_, _, err := writeContext(archive, WithSymlinkPolicy(policy))
+				if err == nil || !strings.Contains(err.Error(), "forbidden symlink link") {
+					t.Errorf("%s with %s policy: want forbidden symlink error, got: %v", linkname, policy, err)
+				}
+			}
+		}
+	})
+
+	t.Run("symlinks in the build context are preserved", func(t *testing.T) {
+		archive := makeArchive(
+			entry{name: "shared/config.yml", data: "config"},
+			entry{name: "function/config.yml", typeflag: tar.TypeSymlink, linkname: "../shared/config.yml"},
+		)
+
+		headers, _, err := writeContext(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		link := headers["context/function/config.yml"]
+		if link == nil || link.Typeflag != tar.TypeSymlink || link.Linkname != "../shared/config.yml" {
+			t.Fatalf("want preserved symlink, got %+v", link)
+		}
+	})
+
+	t.Run("symlinks are followed", func(t *testing.T) {
+		archive := makeArchive(
+			entry{name: "function/lib", typeflag: tar.TypeSymlink, linkname: "../shared"},
+			entry{name: "shared/util.py", data: "util"},
+			entry{name: "shared/sub/helpers.py", data: "helpers"},
+		)
+
+		headers, files, err := writeContext(archive, WithSymlinkPolicy(SymlinkFollow))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := files["context/function/lib/util.py"]; got != "util" {
+			t.Errorf("want content of link target, got %q", got)
+		}
+		if got := files["context/function/lib/sub/helpers.py"]; got != "helpers" {
+			t.Errorf("want nested content of link target, got %q", got)
+		}
+		if hdr := headers["context/function/lib/"]; hdr == nil || hdr.Typeflag != tar.TypeDir {
+			t.Errorf("want link to be replaced by a directory, got %+v", hdr)
+		}
+	})
+
+	t.Run("symlink loops are detected", func(t *testing.T) {
+		archive := makeArchive(
+			entry{name: "Dockerfile", data: "FROM scratch\n"},
+			entry{name: "loop", typeflag: tar.TypeSymlink, linkname: "."},
+		)
+
+		if _, _, err := writeContext(archive, WithSymlinkPolicy(SymlinkFollow)); err == nil || !strings.Contains(err.Error(), "symlink loop detected") {
+			t.Fatalf("want symlink loop error, got: %v", err)
+		}
+	})
+
+	t.Run("deterministic archives", func(t *testing.T) {
+		write := func(entries ...entry) []byte {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			if err := writeTarContext(tw, makeArchive(entries...), newTarConfig([]TarOption{WithDeterministic()})); err != nil {
+				t.Fatal(err)
+			}
+			tw.Close()
+			return buf.Bytes()
+		}
+
+		tar1 := write(entry{name: "b.txt", data: "b"}, entry{name: "a.txt", data: "a"})
+		tar2 := write(entry{name: "a.txt", data: "a"}, entry{name: "./b.txt", data: "b"})
+		if !bytes.Equal(tar1, tar2) {
+			t.Fatal("want identical archives for identical build contexts")
+		}
+	})
+}
+
+// readTarFiles returns the content of each entry in the tar archive by name.
+func readTarFiles(data []byte) (map[string]string, error) {
+	files := map[string]string{}
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[hdr.Name] = string(content)
+	}
+}
@@ -0,0 +1,225 @@
+package sdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// GitHubActionsTokenSource gets an OIDC ID token for the current GitHub Actions
+// workflow run. The workflow requires the `id-token: write` permission so that
+// the ACTIONS_ID_TOKEN_REQUEST_URL and ACTIONS_ID_TOKEN_REQUEST_TOKEN environment
+// variables are set.
+//
+// Tokens are cached until they are about to expire.
+type GitHubActionsTokenSource struct {
+	// Audience requested for the ID token. The default audience of the
+	// GitHub token endpoint is used if empty.
+	Audience string
+
+	// Client used to request the ID token, http.DefaultClient is used if nil.
+	Client *http.Client
+
+	lock  sync.Mutex // guards token
+	token *Token
+}
+
+// Token returns a GitHub Actions OIDC ID token.
+func (ts *GitHubActionsTokenSource) Token() (string, error) {
+	token, err := ts.ExpiringToken()
+	if err != nil {
+		return "", err
+	}
+
+	return token.IDToken, nil
+}
+
+// ExpiringToken returns a GitHub Actions OIDC ID token and its expiry.
+func (ts *GitHubActionsTokenSource) ExpiringToken() (*Token, error) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	if ts.token != nil && !ts.token.Expired() {
+		return ts.token, nil
+	}
+
+	requestURL := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL")
+	requestToken := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	if len(requestURL) == 0 || len(requestToken) == 0 {
+		return nil, fmt.Errorf("ACTIONS_ID_TOKEN_REQUEST_URL and ACTIONS_ID_TOKEN_REQUEST_TOKEN must be set, check the workflow has the id-token: write permission")
+	}
+
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ACTIONS_ID_TOKEN_REQUEST_URL: %w", err)
+	}
+
+	if len(ts.Audience) > 0 {
+		q := u.Query()
+		q.Set("audience", ts.Audience)
+		u.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+requestToken)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "openfaas-go-sdk")
+
+	client := ts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch token: %v", err)
+	}
+
+	if code := res.StatusCode; code < 200 || code > 299 {
+		return nil, fmt.Errorf("unexpected status code: %v\nResponse: %s", res.Status, body)
+	}
+
+	var tokenRes struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(body, &tokenRes); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal token: %s", err)
+	}
+
+	if len(tokenRes.Value) == 0 {
+		return nil, fmt.Errorf("empty ID token returned from GitHub Actions")
+	}
+
+	token := newIDToken(tokenRes.Value)
+	ts.token = token
+
+	return token, nil
+}
+
+// GitLabTokenSource gets an OIDC ID token for the current GitLab CI job.
+//
+// Configure an ID token in the job's id_tokens section and set EnvVar to its name:
+//
+//	deploy:
+//	  id_tokens:
+//	    OPENFAAS_ID_TOKEN:
+//	      aud: https://gw.openfaas.example.com
+//
+// If EnvVar is empty the deprecated CI_JOB_JWT_V2 variable is used.
+type GitLabTokenSource struct {
+	// EnvVar is the name of the environment variable holding the ID token.
+	EnvVar string
+}
+
+// Token returns the GitLab CI OIDC ID token.
+func (ts *GitLabTokenSource) Token() (string, error) {
+	token, err := ts.ExpiringToken()
+	if err != nil {
+		return "", err
+	}
+
+	return token.IDToken, nil
+}
+
+// ExpiringToken returns the GitLab CI OIDC ID token and its expiry.
+func (ts *GitLabTokenSource) ExpiringToken() (*Token, error) {
+	envVar := ts.EnvVar
+	if len(envVar) == 0 {
+		envVar = "CI_JOB_JWT_V2"
+	}
+
+	idToken := strings.TrimSpace(os.Getenv(envVar))
+	if len(idToken) == 0 {
+		return nil, fmt.Errorf("no GitLab CI ID token found in %s, configure id_tokens for the job", envVar)
+	}
+
+	return newIDToken(idToken), nil
+}
+
+// EnvTokenSource gets an ID token from an environment variable.
+type EnvTokenSource struct {
+	// Name of the environment variable holding the ID token.
+	Name string
+}
+
+// Token returns the ID token read from the environment variable.
+func (ts *EnvTokenSource) Token() (string, error) {
+	token, err := ts.ExpiringToken()
+	if err != nil {
+		return "", err
+	}
+
+	return token.IDToken, nil
+}
+
+// ExpiringToken returns the ID token read from the environment variable. The expiry
+// is read from the exp claim if the token is a JWT.
+func (ts *EnvTokenSource) ExpiringToken() (*Token, error) {
+	idToken := strings.TrimSpace(os.Getenv(ts.Name))
+	if len(idToken) == 0 {
+		return nil, fmt.Errorf("no ID token found in environment variable %s", ts.Name)
+	}
+
+	return newIDToken(idToken), nil
+}
+
+// FileTokenSource gets an ID token by reading a file. The file is read on
+// each call so tokens that are rotated on disk are picked up.
+type FileTokenSource struct {
+	// Path of the file holding the ID token.
+	Path string
+}
+
+// Token returns the ID token read from the file.
+func (ts *FileTokenSource) Token() (string, error) {
+	token, err := ts.ExpiringToken()
+	if err != nil {
+		return "", err
+	}
+
+	return token.IDToken, nil
+}
+
+// ExpiringToken returns the ID token read from the file. The expiry
+// is read from the exp claim if the token is a JWT.
+func (ts *FileTokenSource) ExpiringToken() (*Token, error) {
+	data, err := os.ReadFile(ts.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load ID token: %s", err)
+	}
+
+	idToken := strings.TrimSpace(string(data))
+	if len(idToken) == 0 {
+		return nil, fmt.Errorf("no ID token found in %s", ts.Path)
+	}
+
+	return newIDToken(idToken), nil
+}
+
+// newIDToken returns a Token for the raw ID token. The expiry is set from the exp
+// claim when the ID token is a JWT, opaque tokens are returned without an expiry.
+func newIDToken(rawToken string) *Token {
+	expiry, _ := jwtExpiry(rawToken)
+
+	return &Token{
+		IDToken: rawToken,
+		Expiry:  expiry,
+	}
+}
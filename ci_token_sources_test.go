@@ -0,0 +1,157 @@
+package sdk
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func Test_GitHubActionsTokenSource(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	idToken := newTestJWT(t, map[string]any{"sub": "repo:openfaas/go-sdk:ref:refs/heads/master", "exp": expiry.Unix()})
+
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		if got := r.Header.Get("Authorization"); got != "Bearer request-token" {
+			t.Errorf("want Authorization header %q, got %q", "Bearer request-token", got)
+		}
+		if got := r.URL.Query().Get("audience"); got != "https://gw.example.com" {
+			t.Errorf("want audience %q, got %q", "https://gw.example.com", got)
+		}
+		if got := r.URL.Query().Get("api-version"); got != "2.0" {
+			t.Errorf("want existing query parameters to be kept, got api-version %q", got)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"value": idToken})
+	}))
+	defer s.Close()
+
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", s.URL+"/token?api-version=2.0")
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "request-token")
+
+	ts := &GitHubActionsTokenSource{Audience: "https://gw.example.com"}
+
+	for i := 0; i < 2; i++ {
+		got, err := ts.ExpiringToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.IDToken != idToken {
+			t.Fatalf("want token %q, got %q", idToken, got.IDToken)
+		}
+		if !got.Expiry.Equal(expiry) {
+			t.Fatalf("want expiry %s, got %s", expiry, got.Expiry)
+		}
+	}
+
+	if requests != 1 {
+		t.Fatalf("want token to be cached after 1 request, got %d requests", requests)
+	}
+}
+
+func Test_GitHubActionsTokenSource_MissingEnvironment(t *testing.T) {
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", "")
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "")
+
+	ts := &GitHubActionsTokenSource{}
+	if _, err := ts.Token(); err == nil {
+		t.Fatal("want error when the GitHub Actions environment is not set")
+	}
+}
+
+func Test_GitHubActionsTokenSource_ErrorStatus(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer s.Close()
+
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", s.URL)
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "request-token")
+
+	ts := &GitHubActionsTokenSource{}
+	if _, err := ts.Token(); err == nil {
+		t.Fatal("want error for non-2xx response")
+	}
+}
+
+func Test_GitLabTokenSource(t *testing.T) {
+	idToken := newTestJWT(t, map[string]any{"sub": "project_path:openfaas/go-sdk"})
+
+	t.Run("id_tokens variable", func(t *testing.T) {
+		t.Setenv("OPENFAAS_ID_TOKEN", idToken)
+
+		ts := &GitLabTokenSource{EnvVar: "OPENFAAS_ID_TOKEN"}
+		got, err := ts.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != idToken {
+			t.Fatalf("want token %q, got %q", idToken, got)
+		}
+	})
+
+	t.Run("CI_JOB_JWT_V2 is used by default", func(t *testing.T) {
+		t.Setenv("CI_JOB_JWT_V2", idToken)
+
+		ts := &GitLabTokenSource{}
+		got, err := ts.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != idToken {
+			t.Fatalf("want token %q, got %q", idToken, got)
+		}
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		ts := &GitLabTokenSource{EnvVar: "OPENFAAS_ID_TOKEN_NOT_SET"}
+		if _, err := ts.Token(); err == nil {
+			t.Fatal("want error for missing token")
+		}
+	})
+}
+
+func Test_EnvTokenSource(t *testing.T) {
+	t.Setenv("ID_TOKEN", "opaque-token\n")
+
+	ts := &EnvTokenSource{Name: "ID_TOKEN"}
+	got, err := ts.ExpiringToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.IDToken != "opaque-token" {
+		t.Fatalf("want token %q, got %q", "opaque-token", got.IDToken)
+	}
+	if !got.Expiry.IsZero() {
+		t.Fatalf("want no expiry for opaque token, got %s", got.Expiry)
+	}
+}
+
+func Test_FileTokenSource(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	idToken := newTestJWT(t, map[string]any{"exp": expiry.Unix()})
+
+	tokenPath := path.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte(idToken+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := &FileTokenSource{Path: tokenPath}
+	got, err := ts.ExpiringToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.IDToken != idToken {
+		t.Fatalf("want token %q, got %q", idToken, got.IDToken)
+	}
+	if !got.Expiry.Equal(expiry) {
+		t.Fatalf("want expiry %s, got %s", expiry, got.Expiry)
+	}
+}
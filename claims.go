@@ -0,0 +1,199 @@
+package sdk
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Claims are the claims of an OpenFaaS access token or an ID token issued by an IdP.
+type Claims struct {
+	// Subject is the sub claim, the identity the token was issued for.
+	Subject string
+
+	// Issuer is the iss claim, the URL of the token issuer.
+	Issuer string
+
+	// Audience is the aud claim. Function access tokens have the audience
+	// "namespace:name" for each function they can invoke.
+	Audience []string
+
+	// ExpiresAt is the exp claim, a zero value means the token does not expire.
+	ExpiresAt time.Time
+
+	// IssuedAt is the iat claim.
+	IssuedAt time.Time
+
+	// NotBefore is the nbf claim.
+	NotBefore time.Time
+
+	// FedIssuer is the issuer of the federated ID token that was exchanged
+	// for an OpenFaaS access token.
+	FedIssuer string
+
+	// Scope contains the space separated values of the scope claim.
+	Scope []string
+
+	// Raw contains all claims of the token, including claims
+	// that are not mapped to a field.
+	Raw map[string]any
+}
+
+// FunctionPermission is a function an OpenFaaS function access token can invoke.
+type FunctionPermission struct {
+	Namespace string
+	Name      string
+}
+
+// HasScope reports whether scope is one of the scopes of the token.
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scope, scope)
+}
+
+// HasAudience reports whether audience is one of the audiences of the token.
+func (c *Claims) HasAudience(audience string) bool {
+	return slices.Contains(c.Audience, audience)
+}
+
+// Expired reports whether the token is expired.
+func (c *Claims) Expired() bool {
+	return !c.ExpiresAt.IsZero() && c.ExpiresAt.Before(time.Now())
+}
+
+// Functions returns the functions the token can invoke. Only tokens with the
+// function scope have function permissions, they are read from the audiences
+// in the "namespace:name" format.
+func (c *Claims) Functions() []FunctionPermission {
+	if !c.HasScope("function") {
+		return nil
+	}
+
+	var functions []FunctionPermission
+	for _, aud := range c.Audience {
+		namespace, name, ok := strings.Cut(aud, ":")
+		if !ok || len(namespace) == 0 || len(name) == 0 || strings.Contains(aud, "://") {
+			continue
+		}
+		functions = append(functions, FunctionPermission{Namespace: namespace, Name: name})
+	}
+
+	return functions
+}
+
+// Claims decodes the claims of the token without verifying its signature.
+func (t *Token) Claims() (*Claims, error) {
+	return ParseClaims(t.IDToken)
+}
+
+// ParseClaims decodes the claims of a JWT without verifying its signature.
+// Use it to inspect tokens that were obtained from a trusted source, use
+// VerifyClaims to validate tokens received from clients.
+func ParseClaims(rawToken string) (*Claims, error) {
+	_, claims, err := decodeJWT(rawToken)
+	return claims, err
+}
+
+// jwtHeader is the JOSE header of a JWT.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// decodeJWT decodes the header and claims of a JWT without verifying its signature.
+func decodeJWT(rawToken string) (*jwtHeader, *Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, nil, fmt.Errorf("malformed jwt, expected 3 parts got %d", len(parts))
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed jwt header: %w", err)
+	}
+
+	header := &jwtHeader{}
+	if err := json.Unmarshal(headerJSON, header); err != nil {
+		return nil, nil, fmt.Errorf("malformed jwt header: %w", err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed jwt payload: %w", err)
+	}
+
+	claims, err := parseClaimsJSON(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return header, claims, nil
+}
+
+func parseClaimsJSON(payload []byte) (*Claims, error) {
+	var raw struct {
+		Sub       string          `json:"sub"`
+		Iss       string          `json:"iss"`
+		Aud       json.RawMessage `json:"aud"`
+		Exp       json.Number     `json:"exp"`
+		Iat       json.Number     `json:"iat"`
+		Nbf       json.Number     `json:"nbf"`
+		FedIssuer string          `json:"fed_issuer"`
+		Scope     string          `json:"scope"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("malformed jwt claims: %w", err)
+	}
+
+	claims := &Claims{
+		Subject:   raw.Sub,
+		Issuer:    raw.Iss,
+		FedIssuer: raw.FedIssuer,
+		Scope:     strings.Fields(raw.Scope),
+	}
+
+	// The aud claim is either a single string or an array of strings.
+	if len(raw.Aud) > 0 && string(raw.Aud) != "null" {
+		var aud string
+		if err := json.Unmarshal(raw.Aud, &aud); err == nil {
+			claims.Audience = []string{aud}
+		} else if err := json.Unmarshal(raw.Aud, &claims.Audience); err != nil {
+			return nil, fmt.Errorf("malformed aud claim: %w", err)
+		}
+	}
+
+	var err error
+	if claims.ExpiresAt, err = numericDate(raw.Exp); err != nil {
+		return nil, fmt.Errorf("malformed exp claim: %w", err)
+	}
+	if claims.IssuedAt, err = numericDate(raw.Iat); err != nil {
+		return nil, fmt.Errorf("malformed iat claim: %w", err)
+	}
+	if claims.NotBefore, err = numericDate(raw.Nbf); err != nil {
+		return nil, fmt.Errorf("malformed nbf claim: %w", err)
+	}
+
+	if err := json.Unmarshal(payload, &claims.Raw); err != nil {
+		return nil, fmt.Errorf("malformed jwt claims: %w", err)
+	}
+
+	return claims, nil
+}
+
+// numericDate converts a JWT NumericDate to a time, a zero
+// time is returned if the claim is not set.
+func numericDate(n json.Number) (time.Time, error) {
+	if len(n) == 0 {
+		return time.Time{}, nil
+	}
+
+	v, err := n.Float64()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(int64(v), 0), nil
+}
@@ -0,0 +1,278 @@
+package sdk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_ParseClaims(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	iat := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name          string
+		claims        map[string]any
+		wantAudience  []string
+		wantFunctions []FunctionPermission
+	}{
+		{
+			name: "function access token",
+			claims: map[string]any{
+				"sub":        "fed:repo:openfaas/go-sdk",
+				"iss":        "https://gw.example.com",
+				"aud":        []string{"openfaas-fn:env", "openfaas-fn:figlet"},
+				"exp":        exp.Unix(),
+				"iat":        iat.Unix(),
+				"fed_issuer": "https://token.actions.githubusercontent.com",
+				"scope":      "function",
+			},
+			wantAudience: []string{"openfaas-fn:env", "openfaas-fn:figlet"},
+			wantFunctions: []FunctionPermission{
+				{Namespace: "openfaas-fn", Name: "env"},
+				{Namespace: "openfaas-fn", Name: "figlet"},
+			},
+		},
+		{
+			name: "single audience string",
+			claims: map[string]any{
+				"sub":   "fed:repo:openfaas/go-sdk",
+				"iss":   "https://gw.example.com",
+				"aud":   "openfaas-fn:env",
+				"exp":   exp.Unix(),
+				"iat":   iat.Unix(),
+				"scope": "function",
+			},
+			wantAudience:  []string{"openfaas-fn:env"},
+			wantFunctions: []FunctionPermission{{Namespace: "openfaas-fn", Name: "env"}},
+		},
+		{
+			name: "token without function scope has no function permissions",
+			claims: map[string]any{
+				"sub": "user",
+				"iss": "https://gw.example.com",
+				"aud": []string{"https://gw.example.com"},
+				"exp": exp.Unix(),
+				"iat": iat.Unix(),
+			},
+			wantAudience: []string{"https://gw.example.com"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := &Token{IDToken: newTestJWT(t, test.claims)}
+
+			claims, err := token.Claims()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if claims.Subject != test.claims["sub"] {
+				t.Errorf("want subject %v, got %s", test.claims["sub"], claims.Subject)
+			}
+			if claims.Issuer != test.claims["iss"] {
+				t.Errorf("want issuer %v, got %s", test.claims["iss"], claims.Issuer)
+			}
+			if !claims.ExpiresAt.Equal(exp) {
+				t.Errorf("want expiry %s, got %s", exp, claims.ExpiresAt)
+			}
+			if !claims.IssuedAt.Equal(iat) {
+				t.Errorf("want issued at %s, got %s", iat, claims.IssuedAt)
+			}
+			if fedIssuer, _ := test.claims["fed_issuer"].(string); claims.FedIssuer != fedIssuer {
+				t.Errorf("want fed_issuer %q, got %q", fedIssuer, claims.FedIssuer)
+			}
+			if diff := cmp.Diff(test.wantAudience, claims.Audience); diff != "" {
+				t.Errorf("audience mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantFunctions, claims.Functions()); diff != "" {
+				t.Errorf("functions mismatch (-want +got):\n%s", diff)
+			}
+			if claims.Raw["sub"] != test.claims["sub"] {
+				t.Errorf("want raw sub claim %v, got %v", test.claims["sub"], claims.Raw["sub"])
+			}
+		})
+	}
+
+	t.Run("malformed token", func(t *testing.T) {
+		if _, err := ParseClaims("not-a-jwt"); err == nil {
+			t.Fatal("want error for malformed token")
+		}
+	})
+}
+
+func Test_VerifyClaims(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := &JSONWebKeySet{
+		Keys: []JSONWebKey{
+			testJSONWebKey(t, rsaKey.Public(), "rsa"),
+			testJSONWebKey(t, ecKey.Public(), "ec"),
+			testJSONWebKey(t, edKey.Public(), "ed"),
+		},
+	}
+
+	claims := map[string]any{
+		"sub": "user",
+		"iss": "https://gw.example.com",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	for _, key := range []struct {
+		kid    string
+		signer crypto.Signer
+	}{
+		{"rsa", rsaKey},
+		{"ec", ecKey},
+		{"ed", edKey},
+	} {
+		t.Run("valid token signed with "+key.kid+" key", func(t *testing.T) {
+			raw, err := signJWT(key.signer, key.kid, claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := VerifyClaims(raw, jwks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Subject != "user" {
+				t.Errorf("want subject user, got %s", got.Subject)
+			}
+		})
+	}
+
+	t.Run("token signed with a different key", func(t *testing.T) {
+		otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		raw, err := signJWT(otherKey, "ec", claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := VerifyClaims(raw, jwks); err == nil || !strings.Contains(err.Error(), "invalid jwt signature") {
+			t.Fatalf("want invalid signature error, got: %v", err)
+		}
+	})
+
+	t.Run("unknown key ID", func(t *testing.T) {
+		raw, err := signJWT(ecKey, "unknown", claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := VerifyClaims(raw, jwks); !errors.Is(err, ErrUnknownSigningKey) {
+			t.Fatalf("want ErrUnknownSigningKey, got: %v", err)
+		}
+	})
+
+	t.Run("unsigned token", func(t *testing.T) {
+		raw := newTestJWT(t, claims)
+		single := &JSONWebKeySet{Keys: jwks.Keys[:1]}
+
+		if _, err := VerifyClaims(raw, single); err == nil {
+			t.Fatal("want error for token with alg none")
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		raw, err := signJWT(ecKey, "ec", map[string]any{
+			"sub": "user",
+			"exp": time.Now().Add(-time.Hour).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := VerifyClaims(raw, jwks); err == nil || !strings.Contains(err.Error(), "expired") {
+			t.Fatalf("want expired error, got: %v", err)
+		}
+	})
+}
+
+func Test_ExchangeIDToken_ExpiryFromClaims(t *testing.T) {
+	exp := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	accessToken := newTestJWT(t, map[string]any{"sub": "user", "exp": exp.Unix()})
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"` + accessToken + `","token_type":"Bearer"}`))
+	}))
+	defer s.Close()
+
+	token, err := ExchangeIDToken(s.URL, "id-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !token.Expiry.Equal(exp) {
+		t.Fatalf("want expiry from exp claim %s, got %s", exp, token.Expiry)
+	}
+}
+
+func Test_ExchangeIDToken_OAuthError(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, status, OAuthError{Err: "invalid_client", Description: "unknown client"})
+			}))
+			defer s.Close()
+
+			_, err := ExchangeIDToken(s.URL, "id-token")
+
+			var authErr *OAuthError
+			if !errors.As(err, &authErr) {
+				t.Fatalf("want *OAuthError, got: %v", err)
+			}
+			if authErr.Err != "invalid_client" {
+				t.Fatalf("want error invalid_client, got %q", authErr.Err)
+			}
+		})
+	}
+}
+
+// testJSONWebKey returns the JWK for a public key.
+func testJSONWebKey(t *testing.T, pub crypto.PublicKey, kid string) JSONWebKey {
+	t.Helper()
+
+	enc := base64.RawURLEncoding.EncodeToString
+
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return JSONWebKey{Kty: "RSA", Kid: kid, N: enc(key.N.Bytes()), E: enc(big.NewInt(int64(key.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		x, y := make([]byte, 32), make([]byte, 32)
+		key.X.FillBytes(x)
+		key.Y.FillBytes(y)
+		return JSONWebKey{Kty: "EC", Kid: kid, Crv: "P-256", X: enc(x), Y: enc(y)}
+	case ed25519.PublicKey:
+		return JSONWebKey{Kty: "OKP", Kid: kid, Crv: "Ed25519", X: enc(key)}
+	default:
+		t.Fatalf("unsupported key type %T", pub)
+		return JSONWebKey{}
+	}
+}
@@ -43,6 +43,12 @@ type Client struct {
 
 	// OpenFaaS function access token cache for invoking functions.
 	fnTokenCache TokenCache
+
+	// Deduplicates concurrent function access token exchanges.
+	fnExchanges exchangeGroup
+
+	// TLS settings applied to the http client.
+	tlsConfig *httpclient.TLSConfig
 }
 
 // ClientAuth an interface for client authentication.
@@ -75,6 +81,45 @@ func WithFunctionTokenCache(cache TokenCache) ClientOption {
 	}
 }
 
+// WithCABundle configures a PEM encoded CA bundle that is trusted in addition to the
+// system roots for requests to the gateway and the token endpoint.
+func WithCABundle(path string) ClientOption {
+	return func(c *Client) {
+		c.tls().CAFile = path
+	}
+}
+
+// WithClientCertificate configures a client certificate and key for mutual TLS.
+// The files are loaded again when they change so rotated certificates are picked up.
+func WithClientCertificate(certFile, keyFile string) ClientOption {
+	return func(c *Client) {
+		c.tls().CertFile = certFile
+		c.tls().KeyFile = keyFile
+	}
+}
+
+// WithServerName overrides the server name used to verify the certificate of the gateway.
+func WithServerName(name string) ClientOption {
+	return func(c *Client) {
+		c.tls().ServerName = name
+	}
+}
+
+// WithInsecureSkipVerify disables verification of the server certificate.
+// It should only be used for development.
+func WithInsecureSkipVerify() ClientOption {
+	return func(c *Client) {
+		c.tls().InsecureSkipVerify = true
+	}
+}
+
+func (c *Client) tls() *httpclient.TLSConfig {
+	if c.tlsConfig == nil {
+		c.tlsConfig = &httpclient.TLSConfig{}
+	}
+	return c.tlsConfig
+}
+
 // NewClient creates a Client for managing OpenFaaS and invoking functions
 func NewClient(gatewayURL *url.URL, auth ClientAuth, client *http.Client) *Client {
 	return NewClientWithOpts(gatewayURL, client, WithAuthentication(auth))
@@ -83,19 +128,21 @@ func NewClient(gatewayURL *url.URL, auth ClientAuth, client *http.Client) *Clien
 // NewClientWithOpts creates a Client for managing OpenFaaS and invoking functions
 // It takes a list of ClientOptions to configure the client.
 func NewClientWithOpts(gatewayURL *url.URL, client *http.Client, options ...ClientOption) *Client {
-	// Wrap http client to add default headers and support debug capabilities
-	client = httpclient.WithFaasTransport(client)
-
 	c := &Client{
 		GatewayURL: gatewayURL,
-
-		client: client,
 	}
 
 	for _, option := range options {
 		option(c)
 	}
 
+	if c.tlsConfig != nil {
+		client = httpclient.WithTLSConfig(client, c.tlsConfig)
+	}
+
+	// Wrap http client to add default headers and support debug capabilities
+	c.client = httpclient.WithFaasTransport(client)
+
 	if c.ClientAuth != nil && c.FunctionTokenSource == nil {
 		// Use auth as the default function token source for IAM function authentication
 		// if it implements the TokenSource interface.
@@ -105,9 +152,31 @@ func NewClientWithOpts(gatewayURL *url.URL, client *http.Client, options ...Clie
 		}
 	}
 
+	// Token requests use the same transport, proxy, TLS settings and timeouts
+	// as requests to the gateway, unless a client was configured for them.
+	c.setTokenClient(c.ClientAuth)
+	c.setTokenClient(c.FunctionTokenSource)
+
 	return c
 }
 
+// setTokenClient configures the http client of the client's authentication
+// providers and token sources if they do not have a client yet.
+func (c *Client) setTokenClient(v any) {
+	switch auth := v.(type) {
+	case *TokenAuth:
+		if auth.Client == nil {
+			auth.Client = c.client
+		}
+	case *ClientCredentialsAuth:
+		c.setTokenClient(auth.tokenSource)
+	case *ClientCredentialsTokenSource:
+		if auth.client == nil {
+			auth.client = c.client
+		}
+	}
+}
+
 // GetNamespaces get openfaas namespaces
 func (s *Client) GetNamespaces(ctx context.Context) ([]string, error) {
 	namespaces := []string{}
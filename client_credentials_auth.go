@@ -1,13 +1,15 @@
 package sdk
 
 import (
-	"encoding/json"
+	"context"
+	"crypto"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 )
 
 type ClientCredentialsAuth struct {
@@ -21,7 +23,7 @@ func NewClientCredentialsAuth(ts TokenSource) *ClientCredentialsAuth {
 }
 
 func (cca *ClientCredentialsAuth) Set(req *http.Request) error {
-	token, err := cca.tokenSource.Token()
+	token, err := tokenWithContext(req.Context(), cca.tokenSource)
 	if err != nil {
 		return err
 	}
@@ -29,6 +31,21 @@ func (cca *ClientCredentialsAuth) Set(req *http.Request) error {
 	return nil
 }
 
+// ClientAuthMethod is the method used by a client to authenticate
+// with the token endpoint.
+type ClientAuthMethod string
+
+const (
+	// ClientSecretPost sends the client secret in the request body.
+	ClientSecretPost ClientAuthMethod = "client_secret_post"
+
+	// ClientSecretBasic sends the client ID and secret with HTTP Basic authentication.
+	ClientSecretBasic ClientAuthMethod = "client_secret_basic"
+
+	// PrivateKeyJWT authenticates with a JWT signed by the client's private key.
+	PrivateKeyJWT ClientAuthMethod = "private_key_jwt"
+)
+
 // ClientCredentialsTokenSource can be used to obtain
 // an access token using the client credentials grant type.
 // Tested with Keycloak's token endpoint, additional changes may
@@ -40,8 +57,67 @@ type ClientCredentialsTokenSource struct {
 	scope        string
 	grantType    string
 	audience     string
-	token        *Token
-	lock         sync.RWMutex
+	authMethod   ClientAuthMethod
+	signer       crypto.Signer
+	keyID        string
+	extraParams  url.Values
+	client       *http.Client
+
+	lock  sync.Mutex // guards token
+	token *Token
+}
+
+// ClientCredentialsOption is used to implement functional-style options that modify the
+// config of a ClientCredentialsTokenSource.
+type ClientCredentialsOption func(*ClientCredentialsTokenSource)
+
+// WithClientSecret configures the client secret and how it is sent to the token endpoint.
+func WithClientSecret(secret string, method ClientAuthMethod) ClientCredentialsOption {
+	return func(ts *ClientCredentialsTokenSource) {
+		ts.clientSecret = secret
+		ts.authMethod = method
+	}
+}
+
+// WithPrivateKeyJWT configures the client to authenticate with a JWT signed by the
+// private key (RFC 7523). RSA, P-256 ECDSA and Ed25519 keys are supported. The keyID
+// is set as the kid header of the JWT if not empty.
+func WithPrivateKeyJWT(signer crypto.Signer, keyID string) ClientCredentialsOption {
+	return func(ts *ClientCredentialsTokenSource) {
+		ts.signer = signer
+		ts.keyID = keyID
+		ts.authMethod = PrivateKeyJWT
+	}
+}
+
+// WithClientCredentialsScope configures the scope requested for the token.
+func WithClientCredentialsScope(scope []string) ClientCredentialsOption {
+	return func(ts *ClientCredentialsTokenSource) {
+		ts.scope = strings.Join(scope, " ")
+	}
+}
+
+// WithClientCredentialsAudience configures the audience requested for the token.
+func WithClientCredentialsAudience(audience string) ClientCredentialsOption {
+	return func(ts *ClientCredentialsTokenSource) {
+		ts.audience = audience
+	}
+}
+
+// WithClientCredentialsHttpClient configures the http client used for requests to
+// the token endpoint, i.e. to use a proxy or custom CA.
+func WithClientCredentialsHttpClient(client *http.Client) ClientCredentialsOption {
+	return func(ts *ClientCredentialsTokenSource) {
+		ts.client = client
+	}
+}
+
+// WithExtraParams configures additional form parameters that are sent
+// with each token request.
+func WithExtraParams(params url.Values) ClientCredentialsOption {
+	return func(ts *ClientCredentialsTokenSource) {
+		ts.extraParams = params
+	}
 }
 
 func NewClientCredentialsTokenSource(clientID, clientSecret, tokenURL, scope, grantType, audience string) TokenSource {
@@ -52,76 +128,143 @@ func NewClientCredentialsTokenSource(clientID, clientSecret, tokenURL, scope, gr
 		scope:        scope,
 		grantType:    grantType,
 		audience:     audience,
+		authMethod:   ClientSecretPost,
 	}
 }
 
-func (ts *ClientCredentialsTokenSource) Token() (string, error) {
-	ts.lock.RLock()
-	expired := ts.token == nil || ts.token.Expired()
+// NewClientCredentialsTokenSourceWithOpts creates a token source that obtains access tokens
+// using the client credentials grant type.
+// It takes a list of ClientCredentialsOptions to configure client authentication, the
+// requested scope and audience and the http client.
+func NewClientCredentialsTokenSourceWithOpts(clientID, tokenURL string, options ...ClientCredentialsOption) *ClientCredentialsTokenSource {
+	ts := &ClientCredentialsTokenSource{
+		clientID:   clientID,
+		tokenURL:   tokenURL,
+		grantType:  "client_credentials",
+		authMethod: ClientSecretPost,
+	}
 
-	if expired {
-		ts.lock.RUnlock()
+	for _, option := range options {
+		option(ts)
+	}
 
-		token, err := obtainClientCredentialsToken(ts.clientID, ts.clientSecret, ts.tokenURL, ts.scope, ts.grantType, ts.audience)
-		if err != nil {
-			return "", err
-		}
+	return ts
+}
 
-		ts.lock.Lock()
-		ts.token = token
-		ts.lock.Unlock()
+func (ts *ClientCredentialsTokenSource) Token() (string, error) {
+	return ts.TokenContext(context.Background())
+}
 
-		return ts.token.IDToken, nil
+// TokenContext returns a cached access token or obtains a new one if it is expired.
+// The context is used for the request to the token endpoint.
+func (ts *ClientCredentialsTokenSource) TokenContext(ctx context.Context) (string, error) {
+	token, err := ts.ExpiringTokenContext(ctx)
+	if err != nil {
+		return "", err
 	}
 
-	ts.lock.RUnlock()
-	return ts.token.IDToken, nil
+	return token.IDToken, nil
 }
 
-func obtainClientCredentialsToken(clientID, clientSecret, tokenURL, scope, grantType, audience string) (*Token, error) {
+// ExpiringToken returns the access token with its expiry and the scope granted
+// by the token endpoint.
+func (ts *ClientCredentialsTokenSource) ExpiringToken() (*Token, error) {
+	return ts.ExpiringTokenContext(context.Background())
+}
 
-	v := url.Values{}
-	v.Set("client_id", clientID)
-	v.Set("client_secret", clientSecret)
-	v.Set("grant_type", grantType)
-	v.Set("scope", scope)
+// ExpiringTokenContext is like ExpiringToken but uses the context for the request
+// to the token endpoint.
+func (ts *ClientCredentialsTokenSource) ExpiringTokenContext(ctx context.Context) (*Token, error) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
 
-	if len(audience) > 0 {
-		v.Set("audience", audience)
+	if ts.token != nil && !ts.token.Expired() {
+		return ts.token, nil
 	}
 
-	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(v.Encode()))
+	token, err := ts.obtainToken(ctx)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("User-Agent", "openfaas-go-sdk")
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+	ts.token = token
+	return token, nil
+}
+
+func (ts *ClientCredentialsTokenSource) obtainToken(ctx context.Context) (*Token, error) {
+	v := url.Values{}
+	for k, values := range ts.extraParams {
+		v[k] = append([]string{}, values...)
+	}
+
+	v.Set("client_id", ts.clientID)
+	v.Set("grant_type", ts.grantType)
+
+	if len(ts.scope) > 0 {
+		v.Set("scope", ts.scope)
+	}
+
+	if len(ts.audience) > 0 {
+		v.Set("audience", ts.audience)
 	}
 
-	if res.Body != nil {
-		defer res.Body.Close()
+	switch ts.authMethod {
+	case ClientSecretBasic:
+	case PrivateKeyJWT:
+		if ts.signer == nil {
+			return nil, fmt.Errorf("no private key configured for private_key_jwt client authentication")
+		}
+
+		assertion, err := ts.clientAssertion()
+		if err != nil {
+			return nil, err
+		}
+		v.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		v.Set("client_assertion", assertion)
+	default:
+		v.Set("client_secret", ts.clientSecret)
 	}
 
-	body, err := io.ReadAll(res.Body)
+	req, err := newTokenRequest(ctx, ts.tokenURL, v)
 	if err != nil {
-		return nil, fmt.Errorf("cannot fetch token: %v", err)
+		return nil, err
 	}
 
-	if code := res.StatusCode; code < 200 || code > 299 {
-		return nil, fmt.Errorf("unexpected status code: %v\nResponse: %s", res.Status, body)
+	if ts.authMethod == ClientSecretBasic {
+		req.SetBasicAuth(url.QueryEscape(ts.clientID), url.QueryEscape(ts.clientSecret))
 	}
 
-	tj := &tokenJSON{}
-	if err := json.Unmarshal(body, tj); err != nil {
-		return nil, fmt.Errorf("unable to unmarshal token: %s", err)
+	tj, err := doTokenRequest(ts.client, req)
+
+	var authErr *OAuthError
+	if errors.As(err, &authErr) {
+		return nil, fmt.Errorf("failed to obtain client credentials token: %w", authErr)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	return &Token{
 		IDToken: tj.AccessToken,
 		Expiry:  tj.expiry(),
+		Scope:   tj.scope(),
 	}, nil
 }
+
+// clientAssertion creates a JWT to authenticate the client with the token endpoint.
+func (ts *ClientCredentialsTokenSource) clientAssertion() (string, error) {
+	jti, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	return signJWT(ts.signer, ts.keyID, map[string]any{
+		"iss": ts.clientID,
+		"sub": ts.clientID,
+		"aud": ts.tokenURL,
+		"jti": jti,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	})
+}
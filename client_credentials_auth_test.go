@@ -0,0 +1,154 @@
+package sdk
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	cmp "github.com/google/go-cmp/cmp"
+)
+
+func Test_ClientCredentialsTokenSource_ClientSecretPost(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.FormValue("client_secret"); got != "secret" {
+			t.Errorf("want client_secret %q, got %q", "secret", got)
+		}
+		if got := r.FormValue("scope"); got != "openid email" {
+			t.Errorf("want scope %q, got %q", "openid email", got)
+		}
+		if got := r.FormValue("resource"); got != "https://gw.example.com" {
+			t.Errorf("want extra param resource, got %q", got)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"access-token","expires_in":300,"scope":"openid email"}`)
+	}))
+	defer s.Close()
+
+	ts := NewClientCredentialsTokenSourceWithOpts("client", s.URL,
+		WithClientSecret("secret", ClientSecretPost),
+		WithClientCredentialsScope([]string{"openid", "email"}),
+		WithExtraParams(url.Values{"resource": []string{"https://gw.example.com"}}),
+	)
+
+	token, err := ts.ExpiringToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.IDToken != "access-token" {
+		t.Fatalf("want access token %q, got %q", "access-token", token.IDToken)
+	}
+	if diff := cmp.Diff([]string{"openid", "email"}, token.Scope); diff != "" {
+		t.Fatalf("scope mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_ClientCredentialsTokenSource_ClientSecretBasic(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "client" || pass != "secret" {
+			t.Errorf("want basic auth client:secret, got %q:%q", user, pass)
+		}
+		if r.FormValue("client_secret") != "" {
+			t.Error("client_secret should not be sent in the body")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"access-token","expires_in":300}`)
+	}))
+	defer s.Close()
+
+	ts := NewClientCredentialsTokenSourceWithOpts("client", s.URL, WithClientSecret("secret", ClientSecretBasic))
+	if _, err := ts.Token(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_ClientCredentialsTokenSource_PrivateKeyJWT(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tokenURL string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.FormValue("client_assertion_type"); got != "urn:ietf:params:oauth:client-assertion-type:jwt-bearer" {
+			t.Errorf("unexpected client_assertion_type: %q", got)
+		}
+
+		parts := strings.Split(r.FormValue("client_assertion"), ".")
+		if len(parts) != 3 {
+			t.Error("malformed client assertion")
+			return
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		if !ed25519.Verify(pub, []byte(parts[0]+"."+parts[1]), sig) {
+			t.Error("invalid client assertion signature")
+		}
+
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		if !strings.Contains(string(claims), `"aud":"`+tokenURL+`"`) || !strings.Contains(string(claims), `"iss":"client"`) {
+			t.Errorf("unexpected client assertion claims: %s", claims)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"access-token","expires_in":300}`)
+	}))
+	defer s.Close()
+	tokenURL = s.URL
+
+	ts := NewClientCredentialsTokenSourceWithOpts("client", s.URL, WithPrivateKeyJWT(priv, "key-1"))
+	if _, err := ts.Token(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_ClientCredentialsTokenSource_OAuthError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":"invalid_client","error_description":"Invalid client credentials"}`)
+	}))
+	defer s.Close()
+
+	ts := NewClientCredentialsTokenSourceWithOpts("client", s.URL, WithClientSecret("wrong", ClientSecretPost))
+
+	_, err := ts.Token()
+
+	var authErr *OAuthError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("want OAuthError, got %v", err)
+	}
+	if authErr.Err != "invalid_client" {
+		t.Fatalf("want error %q, got %q", "invalid_client", authErr.Err)
+	}
+}
+
+func Test_ClientCredentialsTokenSource_ContextCancelled(t *testing.T) {
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer s.Close()
+	defer close(release)
+
+	ts := NewClientCredentialsTokenSourceWithOpts("client", s.URL,
+		WithClientCredentialsHttpClient(&http.Client{}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := ts.TokenContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want context.DeadlineExceeded, got %v", err)
+	}
+}
@@ -2,17 +2,22 @@ package sdk
 
 import (
 	"context"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"encoding/json"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/openfaas/faas-provider/logs"
 	"github.com/openfaas/faas-provider/types"
 )
@@ -834,3 +839,137 @@ func TestSdk_DeleteSecret(t *testing.T) {
 		})
 	}
 }
+
+func TestSdk_WithCABundle(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/token":
+			w.Write([]byte(`{"access_token":"openfaas-token","token_type":"Bearer","expires_in":3600}`))
+		case "/system/namespaces":
+			if got := r.Header.Get("Authorization"); got != "Bearer openfaas-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`["openfaas-fn"]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	gatewayURL, _ := url.Parse(s.URL)
+	auth := &TokenAuth{
+		TokenURL:    s.URL + "/oauth/token",
+		TokenSource: tokenSourceFunc(func() (string, error) { return "id-token", nil }),
+	}
+
+	client := NewClientWithOpts(gatewayURL, http.DefaultClient,
+		WithAuthentication(auth),
+		WithCABundle(caFile))
+
+	// Both the token exchange and the gateway request have to trust the CA.
+	namespaces, err := client.GetNamespaces(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(namespaces) != 1 || namespaces[0] != "openfaas-fn" {
+		t.Fatalf("want namespaces [openfaas-fn], got %v", namespaces)
+	}
+}
+
+// recordingTransport records the path of each request and fails requests
+// that do not carry the test context value.
+type recordingTransport struct {
+	lock  sync.Mutex
+	paths []string
+}
+
+type testContextKey struct{}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Context().Value(testContextKey{}) != "test" {
+		return nil, fmt.Errorf("request to %s is missing the context of the caller", req.URL.Path)
+	}
+
+	rt.lock.Lock()
+	rt.paths = append(rt.paths, req.URL.Path)
+	rt.lock.Unlock()
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestSdk_HttpClientUsedForAllRequests(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/token", "/idp/token":
+			w.Write([]byte(`{"access_token":"token","token_type":"Bearer","expires_in":3600}`))
+		case "/system/namespaces":
+			w.Write([]byte(`["openfaas-fn"]`))
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer s.Close()
+
+	gatewayURL, _ := url.Parse(s.URL)
+	ctx := context.WithValue(context.Background(), testContextKey{}, "test")
+
+	tokenAuth := &TokenAuth{
+		TokenURL:        s.URL + "/oauth/token",
+		TokenSource:     tokenSourceFunc(func() (string, error) { return "id-token", nil }),
+		ExchangeOptions: []ExchangeOption{WithScope([]string{"openid"})},
+	}
+	clientCredentials := NewClientCredentialsTokenSourceWithOpts("client", s.URL+"/idp/token",
+		WithClientSecret("secret", ClientSecretPost))
+
+	tests := []struct {
+		name string
+		auth ClientAuth
+		ts   TokenSource
+		want []string
+	}{
+		{
+			name: "TokenAuth",
+			auth: tokenAuth,
+			ts:   tokenAuth,
+			want: []string{"/oauth/token", "/system/namespaces", "/oauth/token", "/function/env.openfaas-fn"},
+		},
+		{
+			name: "ClientCredentialsAuth",
+			auth: NewClientCredentialsAuth(clientCredentials),
+			ts:   clientCredentials,
+			want: []string{"/idp/token", "/system/namespaces", "/oauth/token", "/function/env.openfaas-fn"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := &recordingTransport{}
+
+			client := NewClientWithOpts(gatewayURL, &http.Client{Transport: rt},
+				WithAuthentication(test.auth),
+				WithFunctionTokenSource(test.ts))
+
+			if _, err := client.GetNamespaces(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+			res, err := client.InvokeFunction("env", "openfaas-fn", false, true, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if diff := cmp.Diff(test.want, rt.paths); diff != "" {
+				t.Fatalf("requests mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Load populates the struct pointed to by cfg from secrets and environment
+// variables using struct tags:
+//
+//   - secret:"name" reads the secret from /var/openfaas/secrets or the path set by
+//     the environment "secret_mount_path". Use secret:"name,path" to set the field to
+//     the path of the secret file instead of its content.
+//   - env:"name" reads the environment variable, used when no secret is found.
+//   - default:"value" is used when neither the secret nor the environment variable is set.
+//   - required:"true" reports an error if no value was found.
+//
+// Supported field types are string, []byte, bool, all int, uint and float types,
+// time.Duration and []string, which is parsed from a comma separated list.
+// Nested structs without tags are loaded recursively.
+//
+// All errors are aggregated with errors.Join so every missing or invalid
+// field is reported at once.
+func Load(cfg any) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config must be a non-nil pointer to a struct, got %T", cfg)
+	}
+
+	return errors.Join(loadStruct(v.Elem(), "")...)
+}
+
+func loadStruct(v reflect.Value, prefix string) []error {
+	var errs []error
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := prefix + field.Name
+		fv := v.Field(i)
+
+		secretTag, hasSecret := field.Tag.Lookup("secret")
+		envTag, hasEnv := field.Tag.Lookup("env")
+		defaultVal, hasDefault := field.Tag.Lookup("default")
+
+		if !hasSecret && !hasEnv && !hasDefault {
+			if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+				errs = append(errs, loadStruct(fv, name+".")...)
+			}
+			continue
+		}
+
+		raw, found, err := lookupConfigValue(secretTag, envTag)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("field %s: %w", name, err))
+			continue
+		}
+
+		if !found && hasDefault {
+			raw, found = []byte(defaultVal), true
+		}
+
+		if !found {
+			if required, _ := strconv.ParseBool(field.Tag.Get("required")); required {
+				errs = append(errs, fmt.Errorf("field %s: required value not set", name))
+			}
+			continue
+		}
+
+		if err := setConfigField(fv, raw); err != nil {
+			errs = append(errs, fmt.Errorf("field %s: %w", name, err))
+		}
+	}
+
+	return errs
+}
+
+// lookupConfigValue returns the raw value for a field from the secret or
+// environment variable named in its tags.
+func lookupConfigValue(secretTag, envTag string) ([]byte, bool, error) {
+	if len(secretTag) > 0 {
+		key, option, _ := strings.Cut(secretTag, ",")
+		secretPath := getPath(key)
+
+		info, err := os.Stat(secretPath)
+		if err == nil && !info.IsDir() {
+			if option == "path" {
+				return []byte(secretPath), true, nil
+			}
+
+			data, err := ReadSecretBytes(key)
+			if err != nil {
+				return nil, false, err
+			}
+			return data, true, nil
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, false, fmt.Errorf("unable to read secret: %s, error: %s", secretPath, err)
+		}
+	}
+
+	if len(envTag) > 0 {
+		if val, ok := os.LookupEnv(envTag); ok {
+			return []byte(val), true, nil
+		}
+	}
+
+	return nil, false, nil
+}
+
+func setConfigField(fv reflect.Value, raw []byte) error {
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Uint8 {
+		fv.SetBytes(raw)
+		return nil
+	}
+
+	val := strings.TrimSpace(string(raw))
+
+	if fv.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported field type %s", fv.Type())
+		}
+
+		items := []string{}
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				items = append(items, item)
+			}
+		}
+		fv.Set(reflect.ValueOf(items).Convert(fv.Type()))
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+
+	return nil
+}
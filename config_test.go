@@ -0,0 +1,109 @@
+package sdk
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	cmp "github.com/google/go-cmp/cmp"
+)
+
+func Test_Load(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("secret_mount_path", tmpDir)
+	t.Setenv("write_timeout", "30s")
+	t.Setenv("allowed_hosts", "a.example.com, b.example.com")
+	t.Setenv("max_workers", "8")
+
+	if err := os.WriteFile(path.Join(tmpDir, "db-password"), []byte("s3cr3t\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(tmpDir, "tls.crt"), []byte("cert"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type database struct {
+		Password string `secret:"db-password" required:"true"`
+		Port     int    `env:"db_port" default:"5432"`
+	}
+
+	var cfg struct {
+		Database     database
+		WriteTimeout time.Duration `env:"write_timeout" default:"10s"`
+		ReadTimeout  time.Duration `env:"read_timeout" default:"10s"`
+		Hosts        []string      `env:"allowed_hosts"`
+		MaxWorkers   uint          `env:"max_workers"`
+		Debug        bool          `env:"debug" default:"false"`
+		CertPath     string        `secret:"tls.crt,path"`
+		APIKey       string        `secret:"api-key" env:"api_key" default:"dev-key"`
+		Ignored      string
+	}
+
+	if err := Load(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Database.Password != "s3cr3t" {
+		t.Errorf("want password %q, got %q", "s3cr3t", cfg.Database.Password)
+	}
+	if cfg.Database.Port != 5432 {
+		t.Errorf("want port 5432, got %d", cfg.Database.Port)
+	}
+	if cfg.WriteTimeout != 30*time.Second {
+		t.Errorf("want write timeout 30s, got %s", cfg.WriteTimeout)
+	}
+	if cfg.ReadTimeout != 10*time.Second {
+		t.Errorf("want read timeout 10s, got %s", cfg.ReadTimeout)
+	}
+	if diff := cmp.Diff([]string{"a.example.com", "b.example.com"}, cfg.Hosts); diff != "" {
+		t.Errorf("hosts mismatch (-want +got):\n%s", diff)
+	}
+	if cfg.MaxWorkers != 8 {
+		t.Errorf("want 8 workers, got %d", cfg.MaxWorkers)
+	}
+	if cfg.CertPath != path.Join(tmpDir, "tls.crt") {
+		t.Errorf("want cert path %q, got %q", path.Join(tmpDir, "tls.crt"), cfg.CertPath)
+	}
+	if cfg.APIKey != "dev-key" {
+		t.Errorf("want api key %q, got %q", "dev-key", cfg.APIKey)
+	}
+}
+
+func Test_Load_AggregatesErrors(t *testing.T) {
+	t.Setenv("secret_mount_path", t.TempDir())
+	t.Setenv("port", "not-a-number")
+
+	var cfg struct {
+		Password string `secret:"db-password" required:"true"`
+		Token    string `env:"token_not_set" required:"true"`
+		Port     int    `env:"port"`
+	}
+
+	err := Load(&cfg)
+	if err == nil {
+		t.Fatal("want error")
+	}
+
+	for _, field := range []string{"Password", "Token", "Port"} {
+		if !strings.Contains(err.Error(), "field "+field) {
+			t.Errorf("want error for field %s, got: %s", field, err)
+		}
+	}
+}
+
+func Test_Load_InvalidTarget(t *testing.T) {
+	var cfg struct{}
+
+	if err := Load(cfg); err == nil {
+		t.Fatal("want error for non-pointer config")
+	}
+
+	var unsupported struct {
+		Values map[string]string `default:"a=b"`
+	}
+	if err := Load(&unsupported); err == nil || !strings.Contains(err.Error(), "unsupported field type") {
+		t.Fatalf("want unsupported field type error, got: %v", err)
+	}
+}
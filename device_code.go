@@ -0,0 +1,208 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DeviceAuthorization is the response of a device authorization request.
+// The user has to visit VerificationURI and enter UserCode to complete the login.
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval,omitempty"`
+}
+
+// DeviceCodeTokenSource gets an ID token with the OAuth 2.0 device authorization
+// grant (RFC 8628). This flow is suitable for CLIs and devices without a browser.
+//
+// The token is cached and refreshed with the refresh token when it expires. The
+// user is only asked to log in again if no valid token or refresh token is available.
+type DeviceCodeTokenSource struct {
+	// ClientID of the public OAuth client.
+	ClientID string
+
+	// DeviceAuthorizationURL is the device authorization endpoint of the IdP.
+	DeviceAuthorizationURL string
+
+	// TokenURL is the token endpoint of the IdP.
+	TokenURL string
+
+	// Scope requested for the token, i.e. openid, profile and offline_access.
+	Scope []string
+
+	// Client used for requests to the IdP, http.DefaultClient is used if nil.
+	Client *http.Client
+
+	// Store is used to persist the token between runs. Optional.
+	Store TokenStore
+
+	// Prompt is called to ask the user to complete the login. By default the
+	// verification URI and user code are printed to stderr.
+	Prompt func(auth DeviceAuthorization) error
+
+	session interactiveSession
+}
+
+// Token returns an ID token, prompting the user to log in if required.
+func (ts *DeviceCodeTokenSource) Token() (string, error) {
+	token, err := ts.ExpiringToken()
+	if err != nil {
+		return "", err
+	}
+
+	return token.IDToken, nil
+}
+
+// ExpiringToken returns an ID token and its expiry, prompting the user to log in if required.
+func (ts *DeviceCodeTokenSource) ExpiringToken() (*Token, error) {
+	return ts.session.getToken(ts.Store,
+		func(rt string) (*Token, error) {
+			return refreshToken(context.Background(), ts.Client, ts.TokenURL, ts.ClientID, rt)
+		},
+		func() (*Token, error) {
+			return ts.Login(context.Background())
+		},
+	)
+}
+
+// Login runs the device authorization flow and returns the token once the user has
+// completed the login. The token is not cached or persisted in the store.
+func (ts *DeviceCodeTokenSource) Login(ctx context.Context) (*Token, error) {
+	auth, err := ts.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prompt := ts.Prompt
+	if prompt == nil {
+		prompt = printDeviceAuthorization
+	}
+	if err := prompt(*auth); err != nil {
+		return nil, err
+	}
+
+	expiresIn := time.Duration(auth.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = 5 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, expiresIn)
+	defer cancel()
+
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	v := url.Values{}
+	v.Set("grant_type", "urn:ietf:params:oauth:grant-type:device_code")
+	v.Set("device_code", auth.DeviceCode)
+	v.Set("client_id", ts.ClientID)
+
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("device code expired before the login was completed")
+			}
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		token, err := requestToken(ctx, ts.Client, ts.TokenURL, v)
+
+		var authErr *OAuthError
+		if errors.As(err, &authErr) {
+			switch authErr.Err {
+			case "authorization_pending":
+				continue
+			case "slow_down":
+				interval += 5 * time.Second
+				continue
+			case "access_denied":
+				return nil, fmt.Errorf("login was denied: %w", authErr)
+			case "expired_token":
+				return nil, fmt.Errorf("device code expired before the login was completed: %w", authErr)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return token, nil
+	}
+}
+
+func (ts *DeviceCodeTokenSource) authorize(ctx context.Context) (*DeviceAuthorization, error) {
+	v := url.Values{}
+	v.Set("client_id", ts.ClientID)
+	if len(ts.Scope) > 0 {
+		v.Set("scope", strings.Join(ts.Scope, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.DeviceAuthorizationURL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "openfaas-go-sdk")
+
+	client := ts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot request device code: %v", err)
+	}
+
+	if res.StatusCode >= 400 && res.StatusCode < 500 {
+		authErr := &OAuthError{}
+		if err := json.Unmarshal(body, authErr); err == nil && len(authErr.Err) > 0 {
+			return nil, authErr
+		}
+	}
+
+	if code := res.StatusCode; code < 200 || code > 299 {
+		return nil, fmt.Errorf("unexpected status code: %v\nResponse: %s", res.Status, body)
+	}
+
+	auth := &DeviceAuthorization{}
+	if err := json.Unmarshal(body, auth); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal device authorization: %s", err)
+	}
+
+	return auth, nil
+}
+
+func printDeviceAuthorization(auth DeviceAuthorization) error {
+	if len(auth.VerificationURIComplete) > 0 {
+		fmt.Fprintf(os.Stderr, "To log in, open the following URL in a browser:\n\n  %s\n\n", auth.VerificationURIComplete)
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "To log in, open %s in a browser and enter the code: %s\n", auth.VerificationURI, auth.UserCode)
+	return nil
+}
@@ -1,9 +1,8 @@
 package sdk
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"os"
@@ -16,6 +15,10 @@ import (
 // using the token exchange grant type.
 // tokenURL should be the OpenFaaS token endpoint within the internal OIDC service
 func ExchangeIDToken(tokenURL, rawIDToken string, options ...ExchangeOption) (*Token, error) {
+	return exchangeIDToken(context.Background(), tokenURL, rawIDToken, options...)
+}
+
+func exchangeIDToken(ctx context.Context, tokenURL, rawIDToken string, options ...ExchangeOption) (*Token, error) {
 	c := &ExchangeConfig{
 		Client: http.DefaultClient,
 	}
@@ -37,17 +40,14 @@ func ExchangeIDToken(tokenURL, rawIDToken string, options ...ExchangeOption) (*T
 		v.Set("scope", strings.Join(c.Scope, " "))
 	}
 
-	u, _ := url.Parse(tokenURL)
-
-	req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(v.Encode()))
+	req, err := newTokenRequest(ctx, tokenURL, v)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("User-Agent", "openfaas-go-sdk")
-
-	if os.Getenv("FAAS_DEBUG") == "1" {
+	// Requests are already logged by the client if it uses a FaasTransport.
+	_, faasTransport := c.Client.Transport.(*httpclient.FaasTransport)
+	if os.Getenv("FAAS_DEBUG") == "1" && !faasTransport {
 		dump, err := httpclient.DumpRequest(req)
 		if err != nil {
 			return nil, err
@@ -56,41 +56,33 @@ func ExchangeIDToken(tokenURL, rawIDToken string, options ...ExchangeOption) (*T
 		fmt.Println(dump)
 	}
 
-	res, err := c.Client.Do(req)
+	tj, err := doTokenRequest(c.Client, req)
 	if err != nil {
 		return nil, err
 	}
 
-	if res.Body != nil {
-		defer res.Body.Close()
-	}
+	return newAccessToken(tj), nil
+}
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("cannot fetch token: %v", err)
+// newAccessToken returns the access token of a token response of the OpenFaaS
+// token endpoint.
+func newAccessToken(tj *tokenJSON) *Token {
+	token := &Token{
+		IDToken:      tj.AccessToken,
+		Expiry:       tj.expiry(),
+		Scope:        tj.scope(),
+		RefreshToken: tj.RefreshToken,
 	}
 
-	if res.StatusCode == http.StatusBadRequest {
-		authErr := &OAuthError{}
-		if err := json.Unmarshal(body, authErr); err == nil {
-			return nil, authErr
+	// Use the exp claim of the access token if the
+	// token endpoint did not return expires_in.
+	if token.Expiry.IsZero() {
+		if exp, err := jwtExpiry(token.IDToken); err == nil {
+			token.Expiry = exp
 		}
 	}
 
-	if code := res.StatusCode; code < 200 || code > 299 {
-		return nil, fmt.Errorf("unexpected status code: %v\nResponse: %s", res.Status, body)
-	}
-
-	tj := &tokenJSON{}
-	if err := json.Unmarshal(body, tj); err != nil {
-		return nil, fmt.Errorf("unable to unmarshal token: %s", err)
-	}
-
-	return &Token{
-		IDToken: tj.AccessToken,
-		Expiry:  tj.expiry(),
-		Scope:   tj.scope(),
-	}, nil
+	return token
 }
 
 type ExchangeConfig struct {
@@ -0,0 +1,149 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultExecTimeout is the maximum time an exec credential plugin
+// can run if no timeout is configured.
+const defaultExecTimeout = 60 * time.Second
+
+// ExecTokenSource gets an ID token by running an external credential helper,
+// similar to kubectl's exec credential plugins. It can be used as the TokenSource
+// for TokenAuth or with NewClientCredentialsAuth.
+//
+// The command must write a JSON object to stdout with the token and an optional
+// RFC 3339 expiration timestamp:
+//
+//	{"token": "eyJhbGciOi...", "expirationTimestamp": "2025-01-01T12:00:00Z"}
+//
+// A Kubernetes ExecCredential, where the same fields are nested under "status",
+// is accepted as well. If no expiration timestamp is returned, the exp claim is used
+// when the token is a JWT. The token is cached until it is about to expire.
+type ExecTokenSource struct {
+	// Command to run, looked up in PATH if it does not contain a path separator.
+	Command string
+
+	// Args passed to the command.
+	Args []string
+
+	// Env contains additional environment variables for the command.
+	// The command inherits the environment of the current process.
+	Env map[string]string
+
+	// Timeout for running the command, defaults to 60s.
+	Timeout time.Duration
+
+	lock  sync.Mutex // guards token
+	token *Token
+}
+
+// execCredential is the output of an exec credential plugin.
+type execCredential struct {
+	Token               string `json:"token"`
+	ExpirationTimestamp string `json:"expirationTimestamp,omitempty"`
+
+	// Status is set when the plugin returns a Kubernetes ExecCredential.
+	Status *execCredential `json:"status,omitempty"`
+}
+
+// Token returns the ID token from the credential helper.
+func (ts *ExecTokenSource) Token() (string, error) {
+	token, err := ts.ExpiringToken()
+	if err != nil {
+		return "", err
+	}
+
+	return token.IDToken, nil
+}
+
+// ExpiringToken returns the ID token from the credential helper and its expiry.
+func (ts *ExecTokenSource) ExpiringToken() (*Token, error) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	if ts.token != nil && !ts.token.Expired() {
+		return ts.token, nil
+	}
+
+	token, err := ts.run()
+	if err != nil {
+		return nil, err
+	}
+
+	ts.token = token
+	return token, nil
+}
+
+func (ts *ExecTokenSource) run() (*Token, error) {
+	if len(ts.Command) == 0 {
+		return nil, fmt.Errorf("no command configured for exec token source")
+	}
+
+	timeout := ts.Timeout
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, ts.Command, ts.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range ts.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("exec token source %q timed out after %s", ts.Command, timeout)
+		}
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			msg := strings.TrimSpace(stderr.String())
+			if len(msg) == 0 {
+				msg = "no output on stderr"
+			}
+			return nil, fmt.Errorf("exec token source %q exited with code %d: %s", ts.Command, exitErr.ExitCode(), msg)
+		}
+
+		return nil, fmt.Errorf("unable to run exec token source %q: %w", ts.Command, err)
+	}
+
+	cred := &execCredential{}
+	if err := json.Unmarshal(stdout.Bytes(), cred); err != nil {
+		return nil, fmt.Errorf("unable to parse output of exec token source %q, expected JSON with a token field: %s", ts.Command, err)
+	}
+	if cred.Status != nil {
+		cred = cred.Status
+	}
+
+	if len(cred.Token) == 0 {
+		return nil, fmt.Errorf("exec token source %q returned an empty token", ts.Command)
+	}
+
+	token := newIDToken(cred.Token)
+	if len(cred.ExpirationTimestamp) > 0 {
+		expiry, err := time.Parse(time.RFC3339, cred.ExpirationTimestamp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expirationTimestamp returned by exec token source %q: %s", ts.Command, err)
+		}
+		token.Expiry = expiry
+	}
+
+	return token, nil
+}
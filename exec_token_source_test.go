@@ -0,0 +1,106 @@
+package sdk
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ExecTokenSource(t *testing.T) {
+	tmpDir := t.TempDir()
+	countFile := path.Join(tmpDir, "count")
+	expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	script := writeTestScript(t, tmpDir, `echo run >> "$COUNT_FILE"
+echo '{"token":"'"$1"'","expirationTimestamp":"`+expiry.Format(time.RFC3339)+`"}'`)
+
+	ts := &ExecTokenSource{
+		Command: script,
+		Args:    []string{"exec-token"},
+		Env:     map[string]string{"COUNT_FILE": countFile},
+	}
+
+	for i := 0; i < 2; i++ {
+		got, err := ts.ExpiringToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.IDToken != "exec-token" {
+			t.Fatalf("want token %q, got %q", "exec-token", got.IDToken)
+		}
+		if !got.Expiry.Equal(expiry) {
+			t.Fatalf("want expiry %s, got %s", expiry, got.Expiry)
+		}
+	}
+
+	runs, err := os.ReadFile(countFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(runs), "run"); n != 1 {
+		t.Fatalf("want command to run once, ran %d times", n)
+	}
+}
+
+func Test_ExecTokenSource_ExecCredential(t *testing.T) {
+	script := writeTestScript(t, t.TempDir(), `echo '{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","status":{"token":"k8s-token"}}'`)
+
+	ts := &ExecTokenSource{Command: script}
+	got, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "k8s-token" {
+		t.Fatalf("want token %q, got %q", "k8s-token", got)
+	}
+}
+
+func Test_ExecTokenSource_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{
+			name:    "non-zero exit",
+			script:  "echo 'login required, run sso login' >&2\nexit 3",
+			wantErr: "exited with code 3: login required, run sso login",
+		},
+		{
+			name:    "invalid JSON",
+			script:  "echo not-json",
+			wantErr: "unable to parse output",
+		},
+		{
+			name:    "empty token",
+			script:  `echo '{"token":""}'`,
+			wantErr: "returned an empty token",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts := &ExecTokenSource{Command: writeTestScript(t, t.TempDir(), test.script)}
+
+			_, err := ts.Token()
+			if err == nil {
+				t.Fatal("want error")
+			}
+			if !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("want error containing %q, got %q", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func writeTestScript(t *testing.T, dir, body string) string {
+	t.Helper()
+
+	script := path.Join(dir, "credential-helper.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"+body+"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
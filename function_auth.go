@@ -0,0 +1,302 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultJWKSCacheTTL is how long the issuer's keys are cached if no TTL is configured.
+const defaultJWKSCacheTTL = time.Hour
+
+// minJWKSRefreshInterval limits how often the keys are fetched again
+// when a token is signed with an unknown key or the last fetch failed.
+const minJWKSRefreshInterval = time.Minute
+
+// ErrIssuerUnavailable is returned when the signing keys can not be fetched
+// from the issuer, so tokens can not be verified.
+var ErrIssuerUnavailable = errors.New("unable to get the signing keys of the issuer")
+
+// defaultJWKSClient is used to fetch the keys if no Client is configured, so an
+// unavailable issuer does not block requests to the function indefinitely.
+var defaultJWKSClient = &http.Client{Timeout: 10 * time.Second}
+
+// FunctionTokenVerifier verifies the OpenFaaS function access tokens that are sent to a
+// function when it is invoked with authentication, i.e. with InvokeFunction and auth set
+// to true.
+//
+// The signing keys are discovered from the /.well-known/openid-configuration document of
+// the issuer and cached. Tokens must have the function scope and the audience
+// "namespace:name" of the function.
+type FunctionTokenVerifier struct {
+	// Issuer is the URL of the OpenFaaS IAM issuer, i.e. the public URL of the gateway.
+	Issuer string
+
+	// Namespace of the function.
+	Namespace string
+
+	// Name of the function.
+	Name string
+
+	// Client used to fetch the OpenID configuration and keys. If nil, a client
+	// with a timeout of 10 seconds is used.
+	Client *http.Client
+
+	// CacheTTL is how long the keys are cached, defaults to 1 hour. Keys are fetched
+	// earlier when a token is signed with a key that is not in the cache.
+	CacheTTL time.Duration
+
+	lock        sync.Mutex // guards jwks, fetchedAt, attemptedAt, fetchErr and inflight
+	jwks        *JSONWebKeySet
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	fetchErr    error
+	inflight    *jwksCall
+}
+
+// jwksCall is an in-flight fetch of the keys shared by concurrent callers.
+type jwksCall struct {
+	done chan struct{}
+	jwks *JSONWebKeySet
+	err  error
+}
+
+// openIDConfiguration is the subset of the OIDC discovery document used to find the keys.
+type openIDConfiguration struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// claimsContextKey is the request context key for verified token claims.
+type claimsContextKey struct{}
+
+// ClaimsFromContext returns the claims of the function access token
+// added to the request context by FunctionTokenVerifier.Middleware.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok
+}
+
+// Middleware returns an http.Handler that verifies the bearer token of each request
+// before calling next. The claims of the token are available to next with
+// ClaimsFromContext. Requests with a missing or invalid token are rejected with
+// 401 Unauthorized, tokens for another function or without the function scope
+// are rejected with 403 Forbidden. If the keys of the issuer can not be fetched
+// requests are rejected with 503 Service Unavailable. The reason a token was
+// rejected is logged, not sent to the caller.
+func (v *FunctionTokenVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawToken, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := v.Verify(r.Context(), rawToken)
+		if err != nil {
+			log.Printf("Rejected function access token: %s", err)
+
+			switch {
+			case errors.Is(err, ErrIssuerUnavailable):
+				http.Error(w, "unable to verify token", http.StatusServiceUnavailable)
+			case errors.Is(err, ErrForbidden):
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+				http.Error(w, "insufficient scope", http.StatusForbidden)
+			default:
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey{}, claims)))
+	})
+}
+
+// Verify verifies the signature, issuer, audience, expiry and scope of a function access
+// token and returns its claims. The returned error wraps ErrUnauthorized if the token is
+// invalid, ErrForbidden if the token is not valid for this function and ErrIssuerUnavailable
+// if the keys of the issuer can not be fetched.
+func (v *FunctionTokenVerifier) Verify(ctx context.Context, rawToken string) (*Claims, error) {
+	if len(v.Namespace) == 0 || len(v.Name) == 0 {
+		return nil, fmt.Errorf("function namespace and name are required to verify tokens")
+	}
+
+	jwks, err := v.keys(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIssuerUnavailable, err)
+	}
+
+	claims, err := VerifyClaims(rawToken, jwks)
+	if errors.Is(err, ErrUnknownSigningKey) {
+		// The issuer may have rotated its keys.
+		if jwks, err = v.keys(ctx, true); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrIssuerUnavailable, err)
+		}
+		claims, err = VerifyClaims(rawToken, jwks)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnauthorized, err)
+	}
+
+	if claims.ExpiresAt.IsZero() {
+		return nil, fmt.Errorf("%w: token does not have an expiry", ErrUnauthorized)
+	}
+
+	if strings.TrimSuffix(claims.Issuer, "/") != strings.TrimSuffix(v.Issuer, "/") {
+		return nil, fmt.Errorf("%w: invalid issuer %q", ErrUnauthorized, claims.Issuer)
+	}
+
+	audience := fmt.Sprintf("%s:%s", v.Namespace, v.Name)
+	if !claims.HasAudience(audience) {
+		return nil, fmt.Errorf("%w: token is not valid for function %s", ErrForbidden, audience)
+	}
+
+	if !claims.HasScope("function") {
+		return nil, fmt.Errorf("%w: token does not have the function scope", ErrForbidden)
+	}
+
+	return claims, nil
+}
+
+// keys returns the cached keys of the issuer, fetching them if the cache
+// expired. If refresh is true the keys are fetched again unless they were
+// fetched less than a minute ago. A failed fetch is not retried for a minute,
+// the cached keys are used in the meantime if there are any.
+//
+// Concurrent callers share a single fetch, which is not cancelled when ctx is.
+func (v *FunctionTokenVerifier) keys(ctx context.Context, refresh bool) (*JSONWebKeySet, error) {
+	v.lock.Lock()
+
+	ttl := v.CacheTTL
+	if ttl <= 0 {
+		ttl = defaultJWKSCacheTTL
+	}
+
+	age := time.Since(v.fetchedAt)
+	if v.jwks != nil && age < ttl && (!refresh || age < minJWKSRefreshInterval) {
+		jwks := v.jwks
+		v.lock.Unlock()
+		return jwks, nil
+	}
+
+	if v.fetchErr != nil && time.Since(v.attemptedAt) < minJWKSRefreshInterval {
+		jwks, err := v.jwks, v.fetchErr
+		v.lock.Unlock()
+		if jwks != nil {
+			return jwks, nil
+		}
+		return nil, err
+	}
+
+	call := v.inflight
+	if call == nil {
+		call = &jwksCall{done: make(chan struct{})}
+		v.inflight = call
+
+		go func() {
+			jwks, err := v.fetchKeys(context.WithoutCancel(ctx))
+
+			v.lock.Lock()
+			v.attemptedAt = time.Now()
+			v.fetchErr = err
+			if err == nil {
+				v.jwks = jwks
+				v.fetchedAt = v.attemptedAt
+			} else if v.jwks != nil {
+				// Keep using the cached keys if the issuer is unavailable.
+				jwks, err = v.jwks, nil
+			}
+			v.inflight = nil
+			call.jwks, call.err = jwks, err
+			v.lock.Unlock()
+
+			close(call.done)
+		}()
+	}
+	v.lock.Unlock()
+
+	select {
+	case <-call.done:
+		return call.jwks, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetchKeys fetches the keys from the jwks_uri in the OpenID configuration of the issuer.
+func (v *FunctionTokenVerifier) fetchKeys(ctx context.Context) (*JSONWebKeySet, error) {
+	issuer := strings.TrimSuffix(v.Issuer, "/")
+
+	config := &openIDConfiguration{}
+	if err := v.getJSON(ctx, issuer+"/.well-known/openid-configuration", config); err != nil {
+		return nil, fmt.Errorf("unable to get OpenID configuration: %w", err)
+	}
+
+	if strings.TrimSuffix(config.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("issuer %q in OpenID configuration does not match %q", config.Issuer, issuer)
+	}
+	if len(config.JWKSURI) == 0 {
+		return nil, fmt.Errorf("no jwks_uri in OpenID configuration of %s", issuer)
+	}
+
+	jwks := &JSONWebKeySet{}
+	if err := v.getJSON(ctx, config.JWKSURI, jwks); err != nil {
+		return nil, fmt.Errorf("unable to get JSON web key set: %w", err)
+	}
+
+	return jwks, nil
+}
+
+func (v *FunctionTokenVerifier) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "openfaas-go-sdk")
+
+	client := v.Client
+	if client == nil {
+		client = defaultJWKSClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if code := res.StatusCode; code < 200 || code > 299 {
+		return fmt.Errorf("unexpected status code: %v\nResponse: %s", res.Status, body)
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+// bearerToken returns the token from the Authorization header of the request.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, len(token) > 0
+}
@@ -0,0 +1,356 @@
+package sdk
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeIssuer serves the OpenID configuration and keys of an OpenFaaS IAM issuer.
+type fakeIssuer struct {
+	*httptest.Server
+
+	lock sync.Mutex
+	jwks *JSONWebKeySet
+
+	jwksRequests atomic.Int32
+}
+
+func newFakeIssuer(t *testing.T, keys ...JSONWebKey) *fakeIssuer {
+	issuer := &fakeIssuer{jwks: &JSONWebKeySet{Keys: keys}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(openIDConfiguration{
+			Issuer:  issuer.URL,
+			JWKSURI: issuer.URL + "/.well-known/jwks.json",
+		})
+	})
+	mux.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		issuer.jwksRequests.Add(1)
+
+		issuer.lock.Lock()
+		defer issuer.lock.Unlock()
+		json.NewEncoder(w).Encode(issuer.jwks)
+	})
+
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+
+	return issuer
+}
+
+func (i *fakeIssuer) setKeys(keys ...JSONWebKey) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.jwks = &JSONWebKeySet{Keys: keys}
+}
+
+func Test_FunctionTokenVerifier_Middleware(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := newFakeIssuer(t, testJSONWebKey(t, key.Public(), "key1"))
+
+	verifier := &FunctionTokenVerifier{
+		Issuer:    issuer.URL,
+		Namespace: "openfaas-fn",
+		Name:      "env",
+	}
+
+	handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok {
+			t.Error("want claims in request context")
+			return
+		}
+		w.Write([]byte(claims.Subject))
+	}))
+
+	validClaims := func() map[string]any {
+		return map[string]any{
+			"sub":   "fed:repo:openfaas/go-sdk",
+			"iss":   issuer.URL,
+			"aud":   []string{"openfaas-fn:env"},
+			"scope": "function",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		token    func(t *testing.T) string
+		wantCode int
+	}{
+		{
+			name:     "valid token",
+			token:    func(t *testing.T) string { return signTestToken(t, key, "key1", validClaims()) },
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "missing token",
+			token:    func(t *testing.T) string { return "" },
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "token signed with unknown key",
+			token:    func(t *testing.T) string { return signTestToken(t, otherKey, "key1", validClaims()) },
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "expired token",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims["exp"] = time.Now().Add(-time.Hour).Unix()
+				return signTestToken(t, key, "key1", claims)
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "token without expiry",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				delete(claims, "exp")
+				return signTestToken(t, key, "key1", claims)
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "issuer with trailing slash",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims["iss"] = issuer.URL + "/"
+				return signTestToken(t, key, "key1", claims)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "token from another issuer",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims["iss"] = "https://other.example.com"
+				return signTestToken(t, key, "key1", claims)
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "token for another function",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims["aud"] = []string{"openfaas-fn:figlet"}
+				return signTestToken(t, key, "key1", claims)
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "token without function scope",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims["scope"] = "openid"
+				return signTestToken(t, key, "key1", claims)
+			},
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if token := test.token(t); len(token) > 0 {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != test.wantCode {
+				t.Fatalf("want status %d, got %d: %s", test.wantCode, rr.Code, rr.Body.String())
+			}
+			if test.wantCode == http.StatusOK && rr.Body.String() != "fed:repo:openfaas/go-sdk" {
+				t.Fatalf("want subject in response, got %q", rr.Body.String())
+			}
+			if test.wantCode != http.StatusOK && len(rr.Header().Get("WWW-Authenticate")) == 0 {
+				t.Fatal("want WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func Test_FunctionTokenVerifier_KeyCache(t *testing.T) {
+	key1, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key2, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	issuer := newFakeIssuer(t, testJSONWebKey(t, key1.Public(), "key1"))
+
+	verifier := &FunctionTokenVerifier{
+		Issuer:    issuer.URL,
+		Namespace: "openfaas-fn",
+		Name:      "env",
+	}
+
+	claims := map[string]any{
+		"sub":   "user",
+		"iss":   issuer.URL,
+		"aud":   "openfaas-fn:env",
+		"scope": "function",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := verifier.Verify(t.Context(), signTestToken(t, key1, "key1", claims)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := issuer.jwksRequests.Load(); got != 1 {
+		t.Fatalf("want keys to be fetched once, got %d requests", got)
+	}
+
+	t.Run("keys are fetched again after rotation", func(t *testing.T) {
+		issuer.setKeys(testJSONWebKey(t, key1.Public(), "key1"), testJSONWebKey(t, key2.Public(), "key2"))
+
+		// Allow a refresh for the unknown key.
+		verifier.lock.Lock()
+		verifier.fetchedAt = time.Now().Add(-2 * minJWKSRefreshInterval)
+		verifier.lock.Unlock()
+
+		if _, err := verifier.Verify(t.Context(), signTestToken(t, key2, "key2", claims)); err != nil {
+			t.Fatal(err)
+		}
+		if got := issuer.jwksRequests.Load(); got != 2 {
+			t.Fatalf("want keys to be fetched again, got %d requests", got)
+		}
+	})
+
+	t.Run("unknown keys do not refetch more than once per minute", func(t *testing.T) {
+		key3, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+		for i := 0; i < 3; i++ {
+			if _, err := verifier.Verify(t.Context(), signTestToken(t, key3, "key3", claims)); err == nil {
+				t.Fatal("want error for token signed with unknown key")
+			}
+		}
+		if got := issuer.jwksRequests.Load(); got != 2 {
+			t.Fatalf("want no additional key requests, got %d requests", got)
+		}
+	})
+}
+
+func Test_FunctionTokenVerifier_IssuerUnavailable(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	var requests atomic.Int32
+	release := make(chan struct{})
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer issuer.Close()
+
+	verifier := &FunctionTokenVerifier{
+		Issuer:    issuer.URL,
+		Namespace: "openfaas-fn",
+		Name:      "env",
+	}
+
+	token := signTestToken(t, key, "key1", map[string]any{
+		"sub":   "user",
+		"iss":   issuer.URL,
+		"aud":   "openfaas-fn:env",
+		"scope": "function",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := verifier.Verify(t.Context(), token); err == nil {
+				t.Error("want error while the issuer is unavailable")
+			}
+		}()
+	}
+
+	// Wait until all callers share the in-flight fetch before it fails.
+	deadline := time.Now().Add(5 * time.Second)
+	for requests.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if _, err := verifier.Verify(t.Context(), token); !errors.Is(err, ErrIssuerUnavailable) {
+		t.Fatalf("want ErrIssuerUnavailable, got: %v", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("want a single fetch until the retry interval passed, got %d requests", got)
+	}
+
+	t.Run("middleware does not expose the issuer error", func(t *testing.T) {
+		handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("want request to be rejected")
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Fatalf("want status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+		}
+		if body := rr.Body.String(); strings.Contains(body, issuer.URL) || strings.Contains(body, "unavailable") {
+			t.Fatalf("want generic error in response, got %q", body)
+		}
+	})
+
+	t.Run("cancelled caller does not wait for the fetch", func(t *testing.T) {
+		verifier.lock.Lock()
+		verifier.attemptedAt = time.Now().Add(-2 * minJWKSRefreshInterval)
+		verifier.lock.Unlock()
+
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+
+		blocked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		defer blocked.Close()
+		verifier.Issuer = blocked.URL
+		verifier.Client = &http.Client{Timeout: time.Second}
+
+		if _, err := verifier.Verify(ctx, token); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("want context.DeadlineExceeded, got: %v", err)
+		}
+	})
+}
+
+func signTestToken(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+
+	token, err := signJWT(key, kid, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
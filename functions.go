@@ -1,6 +1,7 @@
 package sdk
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 )
@@ -22,42 +23,62 @@ func (c *Client) InvokeFunction(name, namespace string, async bool, auth bool, r
 	req.URL.Path = fmt.Sprintf("%s/%s.%s", fnEndpoint, name, namespace)
 
 	if auth && c.FunctionTokenSource != nil {
-		idToken, err := c.FunctionTokenSource.Token()
+		token, err := c.functionToken(req.Context(), name, namespace)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get function access token: %w", err)
 		}
 
+		req.Header.Add("Authorization", "Bearer "+token.IDToken)
+	}
+
+	return c.client.Do(req)
+}
+
+// functionToken returns an OpenFaaS function access token for the function.
+// Concurrent invocations of the same function share a single token exchange.
+func (c *Client) functionToken(ctx context.Context, name, namespace string) (*Token, error) {
+	cacheKey := fmt.Sprintf("%s.%s", name, namespace)
+
+	if c.fnTokenCache != nil {
+		// Function access tokens are cached as long as the token is valid
+		// to prevent having to do a token exchange each time the function is invoked.
+		if token, ok := c.fnTokenCache.Get(cacheKey); ok {
+			return token, nil
+		}
+	}
+
+	return c.fnExchanges.do(ctx, cacheKey, func(ctx context.Context) (*Token, error) {
+		idToken, err := tokenWithContext(ctx, c.FunctionTokenSource)
+		if err != nil {
+			return nil, err
+		}
+
 		tokenURL := fmt.Sprintf("%s/oauth/token", c.GatewayURL.String())
 		scope := []string{"function"}
 		audience := []string{fmt.Sprintf("%s:%s", namespace, name)}
 
-		var bearer string
+		token, err := exchangeIDToken(ctx, tokenURL, idToken, WithScope(scope), WithAudience(audience), WithHttpClient(c.client))
+		if err != nil {
+			return nil, err
+		}
+
 		if c.fnTokenCache != nil {
-			// Function access tokens are cached as long as the token is valid
-			// to prevent having to do a token exchange each time the function is invoked.
-			cacheKey := fmt.Sprintf("%s.%s", name, namespace)
-			token, ok := c.fnTokenCache.Get(cacheKey)
-			if !ok {
-				token, err = ExchangeIDToken(tokenURL, idToken, WithScope(scope), WithAudience(audience))
-				if err != nil {
-					return nil, fmt.Errorf("failed to get function access token: %w", err)
-				}
-
-				c.fnTokenCache.Set(cacheKey, token)
-			}
-
-			bearer = token.IDToken
-		} else {
-			token, err := ExchangeIDToken(tokenURL, idToken, WithScope(scope), WithAudience(audience))
-			if err != nil {
-				return nil, fmt.Errorf("failed to get function access token: %w", err)
-			}
-
-			bearer = token.IDToken
+			c.fnTokenCache.Set(cacheKey, token)
 		}
 
-		req.Header.Add("Authorization", "Bearer "+bearer)
+		return token, nil
+	})
+}
+
+// FunctionTokenStats returns counters for the function access token cache and the
+// number of token exchanges made for function invocations. Hit, miss and size counters
+// are only set if the configured TokenCache has a Stats method.
+func (c *Client) FunctionTokenStats() TokenCacheStats {
+	var stats TokenCacheStats
+	if cache, ok := c.fnTokenCache.(interface{ Stats() TokenCacheStats }); ok {
+		stats = cache.Stats()
 	}
 
-	return c.client.Do(req)
+	stats.Exchanges = c.fnExchanges.exchanges.Load()
+	return stats
 }
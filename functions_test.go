@@ -0,0 +1,158 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_InvokeFunction_SharesTokenExchange(t *testing.T) {
+	var exchanges, idTokens atomic.Int32
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/token":
+			exchanges.Add(1)
+			// Keep the exchange in flight long enough for concurrent invocations to pile up.
+			time.Sleep(50 * time.Millisecond)
+
+			if err := r.ParseForm(); err != nil {
+				t.Error(err)
+				return
+			}
+			if got := r.Form.Get("audience"); got != "openfaas-fn:env" {
+				t.Errorf("want audience openfaas-fn:env, got: %s", got)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"fn-token","token_type":"Bearer","expires_in":3600,"scope":"function"}`))
+		case "/function/env.openfaas-fn":
+			if got := r.Header.Get("Authorization"); got != "Bearer fn-token" {
+				t.Errorf("want function access token, got: %q", got)
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	gatewayURL, _ := url.Parse(s.URL)
+
+	tests := []struct {
+		name  string
+		cache TokenCache
+		want  int32
+	}{
+		{name: "with token cache", cache: NewMemoryTokenCache(), want: 1},
+		{name: "without token cache", cache: nil, want: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exchanges.Store(0)
+			idTokens.Store(0)
+
+			ts := tokenSourceFunc(func() (string, error) {
+				idTokens.Add(1)
+				return "id-token", nil
+			})
+
+			client := NewClientWithOpts(gatewayURL, http.DefaultClient,
+				WithFunctionTokenSource(ts),
+				WithFunctionTokenCache(test.cache))
+
+			var wg sync.WaitGroup
+			start := make(chan struct{})
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+
+					req, _ := http.NewRequest(http.MethodGet, "/", nil)
+					res, err := client.InvokeFunction("env", "openfaas-fn", false, true, req)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					res.Body.Close()
+				}()
+			}
+			close(start)
+			wg.Wait()
+
+			if got := exchanges.Load(); got != test.want {
+				t.Errorf("want %d token exchanges, got: %d", test.want, got)
+			}
+			if got := idTokens.Load(); got != exchanges.Load() {
+				t.Errorf("want an ID token only for each exchange, got: %d ID tokens for %d exchanges", got, exchanges.Load())
+			}
+		})
+	}
+}
+
+func Test_InvokeFunction_TokenStats(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth/token" {
+			w.Write([]byte(`{"access_token":"fn-token","token_type":"Bearer","expires_in":3600}`))
+			return
+		}
+	}))
+	defer s.Close()
+
+	gatewayURL, _ := url.Parse(s.URL)
+	client := NewClientWithOpts(gatewayURL, http.DefaultClient,
+		WithFunctionTokenSource(tokenSourceFunc(func() (string, error) { return "id-token", nil })),
+		WithFunctionTokenCache(NewMemoryTokenCache()))
+
+	for _, name := range []string{"env", "env", "env", "figlet"} {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		res, err := client.InvokeFunction(name, "", false, true, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	want := TokenCacheStats{Hits: 2, Misses: 2, Exchanges: 2, Size: 2}
+	if got := client.FunctionTokenStats(); got != want {
+		t.Errorf("want stats: %+v, got: %+v", want, got)
+	}
+}
+
+// tokenSourceFunc adapts a function to the TokenSource interface.
+type tokenSourceFunc func() (string, error)
+
+func (f tokenSourceFunc) Token() (string, error) {
+	return f()
+}
+
+func Test_InvokeFunction_ContextCancelledDuringExchange(t *testing.T) {
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{"access_token":"fn-token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer s.Close()
+	defer close(release)
+
+	gatewayURL, _ := url.Parse(s.URL)
+	client := NewClientWithOpts(gatewayURL, http.DefaultClient,
+		WithFunctionTokenSource(tokenSourceFunc(func() (string, error) { return "id-token", nil })))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	_, err := client.InvokeFunction("env", "openfaas-fn", false, true, req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want context deadline exceeded, got: %v", err)
+	}
+}
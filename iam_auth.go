@@ -1,12 +1,15 @@
 package sdk
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path"
+	"strings"
 	"sync"
+	"time"
 )
 
 // A TokenSource is anything that can return an OIDC ID token that can be exchanged for
@@ -18,6 +21,10 @@ type TokenSource interface {
 
 // TokenAuth bearer token authentication for OpenFaaS deployments with OpenFaaS IAM
 // enabled.
+//
+// Concurrent callers share a single in-flight token exchange. If the token endpoint
+// returns a refresh token it is used to get a new token before falling back to
+// exchanging a new ID token from the TokenSource.
 type TokenAuth struct {
 	// TokenURL represents the OpenFaaS gateways token endpoint URL.
 	TokenURL string
@@ -25,15 +32,45 @@ type TokenAuth struct {
 	// TokenSource used to get an ID token that can be exchanged for an OpenFaaS ID token.
 	TokenSource TokenSource
 
-	lock  sync.Mutex // guards token
+	// RefreshFraction is the fraction of the token lifetime after which the token is
+	// refreshed in the background, i.e. 0.8 refreshes a token with a lifetime of 10 minutes
+	// after 8 minutes. Callers keep using the current token while it is being refreshed.
+	// Proactive refresh is disabled if zero.
+	RefreshFraction float64
+
+	// Client used for requests to the token endpoint. When TokenAuth is used with a
+	// Client it defaults to the Client's http client, otherwise http.DefaultClient is used.
+	Client *http.Client
+
+	// ExchangeOptions are applied to each token exchange, i.e. to request
+	// a scope or audience.
+	ExchangeOptions []ExchangeOption
+
+	lock     sync.Mutex // guards token, issuedAt, inflight and failedAt
+	token    *Token
+	issuedAt time.Time
+	inflight *tokenCall
+
+	// failedAt is the time of the last failed token request, proactive
+	// refreshes are not retried until refreshRetryInterval has passed.
+	failedAt time.Time
+}
+
+// refreshRetryInterval is the time to wait before a failed refresh is retried.
+const refreshRetryInterval = 5 * time.Second
+
+// tokenCall is an in-flight or completed token request shared by concurrent callers.
+type tokenCall struct {
+	done  chan struct{}
 	token *Token
+	err   error
 }
 
 // Set Authorization Bearer header on request.
 // Set validates the token expiry on each call. If it's expired it will exchange
 // an ID token from the TokenSource for a new OpenFaaS token.
 func (a *TokenAuth) Set(req *http.Request) error {
-	token, err := a.getToken()
+	token, err := a.TokenContext(req.Context())
 	if err != nil {
 		return err
 	}
@@ -43,33 +80,190 @@ func (a *TokenAuth) Set(req *http.Request) error {
 }
 
 func (a *TokenAuth) Token() (string, error) {
-	return a.getToken()
+	return a.TokenContext(context.Background())
 }
 
-func (a *TokenAuth) getToken() (string, error) {
+// TokenContext returns a valid OpenFaaS token. If a new token has to be obtained,
+// TokenContext waits for it until the context is cancelled. Cancelling the context
+// does not cancel a token request that other callers are waiting for.
+func (a *TokenAuth) TokenContext(ctx context.Context) (string, error) {
 	a.lock.Lock()
-	defer a.lock.Unlock()
+	if a.token != nil && !a.token.Expired() {
+		token := a.token
+		if a.refreshDue() {
+			a.startRefresh(ctx)
+		}
+		a.lock.Unlock()
 
-	if a.token == nil || a.token.Expired() {
-		idToken, err := a.TokenSource.Token()
-		if err != nil {
-			return "", err
+		return token.IDToken, nil
+	}
+
+	call := a.startRefresh(ctx)
+	a.lock.Unlock()
+
+	select {
+	case <-call.done:
+		if call.err != nil {
+			return "", call.err
 		}
+		return call.token.IDToken, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
 
-		token, err := ExchangeIDToken(a.TokenURL, idToken)
+// StartRefresh keeps the token up to date in the background by refreshing it
+// once RefreshFraction of its lifetime has passed, or 80% if RefreshFraction is
+// not set. Refreshes are at least 5 seconds apart, so failed refreshes are retried
+// every 5 seconds. StartRefresh blocks until the context is cancelled.
+func (a *TokenAuth) StartRefresh(ctx context.Context) {
+	var minWait time.Duration
+	for {
+		a.lock.Lock()
+		wait, ok := a.nextRefresh()
+		a.lock.Unlock()
 
-		var authError *OAuthError
-		if errors.As(err, &authError) {
-			return "", fmt.Errorf("failed to exchange token for an OpenFaaS token: %s", authError.Description)
+		if !ok {
+			// Tokens without an expiry never need to be refreshed.
+			<-ctx.Done()
+			return
 		}
-		if err != nil {
-			return "", fmt.Errorf("failed to exchange token for an OpenFaaS token: %s", err)
+
+		// A token with a lifetime shorter than expiryDelta is already expired
+		// when it is issued, wait anyway so that it is not refreshed in a loop.
+		wait = max(wait, minWait)
+		if wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		a.lock.Lock()
+		call := a.startRefresh(ctx)
+		a.lock.Unlock()
+
+		select {
+		case <-call.done:
+			minWait = refreshRetryInterval
+		case <-ctx.Done():
+			return
 		}
+	}
+}
+
+// nextRefresh returns how long to wait until the token should be refreshed, or
+// false if the token has no expiry and never needs to be refreshed. The caller
+// must hold a.lock.
+func (a *TokenAuth) nextRefresh() (time.Duration, bool) {
+	if a.token == nil || a.token.Expired() {
+		return 0, true
+	}
+	if a.token.Expiry.IsZero() {
+		return 0, false
+	}
 
-		a.token = token
+	fraction := a.RefreshFraction
+	if fraction <= 0 || fraction >= 1 {
+		fraction = 0.8
 	}
 
-	return a.token.IDToken, nil
+	lifetime := a.token.Expiry.Sub(a.issuedAt)
+	return time.Until(a.issuedAt.Add(time.Duration(float64(lifetime) * fraction))), true
+}
+
+// refreshDue reports whether the current token should be refreshed
+// proactively. A failed refresh is not retried until refreshRetryInterval
+// has passed. The caller must hold a.lock.
+func (a *TokenAuth) refreshDue() bool {
+	if a.RefreshFraction <= 0 || a.token == nil {
+		return false
+	}
+	if time.Since(a.failedAt) < refreshRetryInterval {
+		return false
+	}
+
+	wait, ok := a.nextRefresh()
+	return ok && wait <= 0
+}
+
+// startRefresh starts a token request or returns the request that is already in
+// flight. The caller must hold a.lock.
+func (a *TokenAuth) startRefresh(ctx context.Context) *tokenCall {
+	if a.inflight != nil {
+		return a.inflight
+	}
+
+	call := &tokenCall{done: make(chan struct{})}
+	a.inflight = call
+
+	var refreshToken string
+	if a.token != nil {
+		refreshToken = a.token.RefreshToken
+	}
+
+	go func() {
+		issuedAt := time.Now()
+		token, err := a.fetchToken(context.WithoutCancel(ctx), refreshToken)
+
+		a.lock.Lock()
+		if err == nil {
+			a.token = token
+			a.issuedAt = issuedAt
+			a.failedAt = time.Time{}
+		} else {
+			a.failedAt = time.Now()
+		}
+		a.inflight = nil
+		call.token, call.err = token, err
+		a.lock.Unlock()
+
+		close(call.done)
+	}()
+
+	return call
+}
+
+// fetchToken gets a new OpenFaaS token using the refresh token if available,
+// otherwise an ID token from the TokenSource is exchanged.
+func (a *TokenAuth) fetchToken(ctx context.Context, rt string) (*Token, error) {
+	if len(rt) > 0 {
+		// Fall back to a token exchange if the refresh token was
+		// revoked or has expired.
+		if token, err := refreshAccessToken(ctx, a.Client, a.TokenURL, rt); err == nil {
+			return token, nil
+		}
+	}
+
+	idToken, err := idTokenFromSource(a.TokenSource)
+	if err != nil {
+		return nil, err
+	}
+
+	var options []ExchangeOption
+	if a.Client != nil {
+		options = append(options, WithHttpClient(a.Client))
+	}
+	options = append(options, a.ExchangeOptions...)
+
+	token, err := exchangeIDToken(ctx, a.TokenURL, idToken.IDToken, options...)
+
+	var authError *OAuthError
+	if errors.As(err, &authError) {
+		return nil, fmt.Errorf("failed to exchange token for an OpenFaaS token: %s", authError.Description)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange token for an OpenFaaS token: %s", err)
+	}
+
+	// Refresh no later than the ID token expires when neither expires_in
+	// nor an exp claim was returned for the OpenFaaS token.
+	if token.Expiry.IsZero() {
+		token.Expiry = idToken.Expiry
+	}
+
+	return token, nil
 }
 
 // A TokenSource to get ID token by reading a Kubernetes projected service account token
@@ -81,12 +275,11 @@ type ServiceAccountTokenSource struct{}
 // /var/secrets/tokens/openfaas-token or the path set by the token_mount_path
 // environment variable.
 func (ts *ServiceAccountTokenSource) Token() (string, error) {
-	tokenMountPath := getEnv("token_mount_path", "/var/secrets/tokens")
-	if len(tokenMountPath) == 0 {
-		return "", fmt.Errorf("invalid token_mount_path specified for reading the service account token")
+	idTokenPath, err := serviceAccountTokenPath()
+	if err != nil {
+		return "", err
 	}
 
-	idTokenPath := path.Join(tokenMountPath, "openfaas-token")
 	idToken, err := os.ReadFile(idTokenPath)
 	if err != nil {
 		return "", fmt.Errorf("unable to load service account token: %s", err)
@@ -95,6 +288,116 @@ func (ts *ServiceAccountTokenSource) Token() (string, error) {
 	return string(idToken), nil
 }
 
+// An ExpiringTokenSource is a TokenSource that also reports when the
+// returned ID token expires.
+type ExpiringTokenSource interface {
+	TokenSource
+
+	// ExpiringToken returns the ID token and its expiry or an error.
+	ExpiringToken() (*Token, error)
+}
+
+// CachedServiceAccountTokenSource gets an ID token by reading a Kubernetes projected
+// service account token from /var/secrets/tokens/openfaas-token or the path set by the
+// token_mount_path environment variable.
+//
+// Unlike ServiceAccountTokenSource the token is cached until it is about to expire
+// or until the kubelet rotates the projected token file.
+type CachedServiceAccountTokenSource struct {
+	lock    sync.Mutex // guards token, modTime and size
+	token   *Token
+	modTime time.Time
+	size    int64
+}
+
+// NewCachedServiceAccountTokenSource creates a token source that caches the
+// projected service account token.
+func NewCachedServiceAccountTokenSource() *CachedServiceAccountTokenSource {
+	return &CachedServiceAccountTokenSource{}
+}
+
+// Token returns the cached service account token, re-reading it from disk
+// when it is about to expire or the file was rotated.
+func (ts *CachedServiceAccountTokenSource) Token() (string, error) {
+	token, err := ts.ExpiringToken()
+	if err != nil {
+		return "", err
+	}
+
+	return token.IDToken, nil
+}
+
+// ExpiringToken returns the cached service account token with the expiry
+// parsed from its exp claim.
+func (ts *CachedServiceAccountTokenSource) ExpiringToken() (*Token, error) {
+	idTokenPath, err := serviceAccountTokenPath()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(idTokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load service account token: %s", err)
+	}
+
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	rotated := !info.ModTime().Equal(ts.modTime) || info.Size() != ts.size
+	if ts.token != nil && !rotated && !ts.token.Expired() {
+		return ts.token, nil
+	}
+
+	idToken, err := os.ReadFile(idTokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load service account token: %s", err)
+	}
+
+	rawToken := strings.TrimSpace(string(idToken))
+	expiry, err := jwtExpiry(rawToken)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse service account token: %s", err)
+	}
+
+	token := &Token{
+		IDToken: rawToken,
+		Expiry:  expiry,
+	}
+	if token.Expired() {
+		return nil, fmt.Errorf("service account token in %s expired at %s", idTokenPath, expiry.Format(time.RFC3339))
+	}
+
+	ts.token = token
+	ts.modTime = info.ModTime()
+	ts.size = info.Size()
+
+	return token, nil
+}
+
+// idTokenFromSource gets an ID token from ts. The expiry of the returned
+// token is only set if ts is an ExpiringTokenSource.
+func idTokenFromSource(ts TokenSource) (*Token, error) {
+	if ets, ok := ts.(ExpiringTokenSource); ok {
+		return ets.ExpiringToken()
+	}
+
+	idToken, err := ts.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Token{IDToken: idToken}, nil
+}
+
+func serviceAccountTokenPath() (string, error) {
+	tokenMountPath := getEnv("token_mount_path", "/var/secrets/tokens")
+	if len(tokenMountPath) == 0 {
+		return "", fmt.Errorf("invalid token_mount_path specified for reading the service account token")
+	}
+
+	return path.Join(tokenMountPath, "openfaas-token"), nil
+}
+
 func getEnv(key, defaultVal string) string {
 	if v, ok := os.LookupEnv(key); ok {
 		return v
@@ -0,0 +1,442 @@
+package sdk
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cmp "github.com/google/go-cmp/cmp"
+)
+
+func Test_CachedServiceAccountTokenSource(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("token_mount_path", tmpDir)
+	tokenPath := path.Join(tmpDir, "openfaas-token")
+
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	token1 := newTestJWT(t, map[string]any{"sub": "token1", "exp": expiry.Unix()})
+	if err := os.WriteFile(tokenPath, []byte(token1), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := NewCachedServiceAccountTokenSource()
+
+	got, err := ts.ExpiringToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.IDToken != token1 {
+		t.Fatalf("want token %q, got %q", token1, got.IDToken)
+	}
+	if !got.Expiry.Equal(expiry) {
+		t.Fatalf("want expiry %s, got %s", expiry, got.Expiry)
+	}
+
+	t.Run("cached token is returned while file is unchanged", func(t *testing.T) {
+		info, err := os.Stat(tokenPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Overwrite the file with a token of the same size and restore the
+		// modification time so the change is not detected.
+		sameSize := newTestJWT(t, map[string]any{"sub": "token2", "exp": expiry.Unix()})
+		if err := os.WriteFile(tokenPath, []byte(sameSize), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(tokenPath, info.ModTime(), info.ModTime()); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ts.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != token1 {
+			t.Fatalf("want cached token %q, got %q", token1, got)
+		}
+	})
+
+	t.Run("rotated token is read from disk", func(t *testing.T) {
+		rotated := newTestJWT(t, map[string]any{"sub": "rotated", "exp": expiry.Add(time.Hour).Unix()})
+		if err := os.WriteFile(tokenPath, []byte(rotated), 0600); err != nil {
+			t.Fatal(err)
+		}
+		modTime := time.Now().Add(time.Minute)
+		if err := os.Chtimes(tokenPath, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ts.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != rotated {
+			t.Fatalf("want rotated token %q, got %q", rotated, got)
+		}
+	})
+
+	t.Run("expired token is rejected", func(t *testing.T) {
+		expired := newTestJWT(t, map[string]any{"sub": "expired", "exp": time.Now().Add(-time.Minute).Unix()})
+		if err := os.WriteFile(tokenPath, []byte(expired), 0600); err != nil {
+			t.Fatal(err)
+		}
+		modTime := time.Now().Add(2 * time.Minute)
+		if err := os.Chtimes(tokenPath, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ts.Token(); err == nil {
+			t.Fatal("want error for expired token")
+		}
+	})
+}
+
+func Test_TokenAuth_UsesIDTokenExpiry(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("token_mount_path", tmpDir)
+
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	idToken := newTestJWT(t, map[string]any{"sub": "fn", "exp": expiry.Unix()})
+	if err := os.WriteFile(path.Join(tmpDir, "openfaas-token"), []byte(idToken), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.FormValue("subject_token"); got != idToken {
+			t.Errorf("want subject_token %q, got %q", idToken, got)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"openfaas-token","token_type":"Bearer"}`)
+	}))
+	defer s.Close()
+
+	auth := &TokenAuth{
+		TokenURL:    s.URL,
+		TokenSource: NewCachedServiceAccountTokenSource(),
+	}
+
+	got, err := auth.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "openfaas-token" {
+		t.Fatalf("want %q, got %q", "openfaas-token", got)
+	}
+
+	if !auth.token.Expiry.Equal(expiry) {
+		t.Fatalf("want OpenFaaS token expiry %s, got %s", expiry, auth.token.Expiry)
+	}
+}
+
+// newTestJWT creates an unsigned JWT with the given claims.
+func newTestJWT(t *testing.T, claims map[string]any) string {
+	t.Helper()
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	return header + "." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+func Test_TokenAuth_ConcurrentCallersShareExchange(t *testing.T) {
+	var exchanges atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exchanges.Add(1)
+		time.Sleep(50 * time.Millisecond)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"openfaas-token","token_type":"Bearer","expires_in":3600}`)
+	}))
+	defer s.Close()
+
+	auth := &TokenAuth{
+		TokenURL:    s.URL,
+		TokenSource: &EnvTokenSource{Name: "TEST_ID_TOKEN"},
+	}
+	t.Setenv("TEST_ID_TOKEN", "id-token")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			got, err := auth.Token()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if got != "openfaas-token" {
+				t.Errorf("want %q, got %q", "openfaas-token", got)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := exchanges.Load(); n != 1 {
+		t.Fatalf("want 1 token exchange, got %d", n)
+	}
+}
+
+func Test_TokenAuth_UsesRefreshToken(t *testing.T) {
+	var grants []string
+	var lock sync.Mutex
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		grants = append(grants, r.FormValue("grant_type"))
+		lock.Unlock()
+
+		if r.FormValue("grant_type") == "refresh_token" && r.FormValue("refresh_token") != "refresh-1" {
+			t.Errorf("want refresh token %q, got %q", "refresh-1", r.FormValue("refresh_token"))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"openfaas-token","refresh_token":"refresh-1","expires_in":3600}`)
+	}))
+	defer s.Close()
+
+	t.Setenv("TEST_ID_TOKEN", "id-token")
+	auth := &TokenAuth{
+		TokenURL:    s.URL,
+		TokenSource: &EnvTokenSource{Name: "TEST_ID_TOKEN"},
+	}
+
+	if _, err := auth.Token(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expire the token so the next call has to get a new one.
+	auth.lock.Lock()
+	auth.token.Expiry = time.Now().Add(-time.Minute)
+	auth.lock.Unlock()
+
+	if _, err := auth.Token(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"urn:ietf:params:oauth:grant-type:token-exchange", "refresh_token"}
+	if diff := cmp.Diff(want, grants); diff != "" {
+		t.Fatalf("grant types mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_TokenAuth_ProactiveRefresh(t *testing.T) {
+	var exchanges atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := exchanges.Add(1)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"openfaas-token-%d","expires_in":3600}`, n)
+	}))
+	defer s.Close()
+
+	t.Setenv("TEST_ID_TOKEN", "id-token")
+	auth := &TokenAuth{
+		TokenURL:        s.URL,
+		TokenSource:     &EnvTokenSource{Name: "TEST_ID_TOKEN"},
+		RefreshFraction: 0.5,
+	}
+
+	if _, err := auth.Token(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Move the token back in time so that more than half of its lifetime has passed.
+	auth.lock.Lock()
+	auth.issuedAt = auth.issuedAt.Add(-45 * time.Minute)
+	auth.token.Expiry = auth.token.Expiry.Add(-45 * time.Minute)
+	auth.lock.Unlock()
+
+	got, err := auth.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "openfaas-token-1" {
+		t.Fatalf("want current token to be returned while refreshing, got %q", got)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if got, _ := auth.Token(); got == "openfaas-token-2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the token to be refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_TokenAuth_RefreshUsesAccessToken(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("grant_type") == "refresh_token" {
+			fmt.Fprint(w, `{"access_token":"openfaas-token-2","id_token":"oidc-id-token","refresh_token":"refresh-1","expires_in":3600}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"openfaas-token-1","refresh_token":"refresh-1","expires_in":3600}`)
+	}))
+	defer s.Close()
+
+	t.Setenv("TEST_ID_TOKEN", "id-token")
+	auth := &TokenAuth{
+		TokenURL:    s.URL,
+		TokenSource: &EnvTokenSource{Name: "TEST_ID_TOKEN"},
+	}
+
+	if _, err := auth.Token(); err != nil {
+		t.Fatal(err)
+	}
+
+	auth.lock.Lock()
+	auth.token.Expiry = time.Now().Add(-time.Minute)
+	auth.lock.Unlock()
+
+	got, err := auth.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "openfaas-token-2" {
+		t.Fatalf("want access token after refresh, got %q", got)
+	}
+}
+
+func Test_TokenAuth_ProactiveRefreshBackoff(t *testing.T) {
+	var requests atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"openfaas-token","expires_in":3600}`)
+	}))
+	defer s.Close()
+
+	t.Setenv("TEST_ID_TOKEN", "id-token")
+	auth := &TokenAuth{
+		TokenURL:        s.URL,
+		TokenSource:     &EnvTokenSource{Name: "TEST_ID_TOKEN"},
+		RefreshFraction: 0.5,
+	}
+
+	if _, err := auth.Token(); err != nil {
+		t.Fatal(err)
+	}
+
+	auth.lock.Lock()
+	auth.issuedAt = auth.issuedAt.Add(-45 * time.Minute)
+	auth.token.Expiry = auth.token.Expiry.Add(-45 * time.Minute)
+	auth.lock.Unlock()
+
+	if _, err := auth.Token(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the proactive refresh to fail.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		auth.lock.Lock()
+		failed := !auth.failedAt.IsZero()
+		auth.lock.Unlock()
+		if failed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the refresh to fail")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for i := 0; i < 10; i++ {
+		got, err := auth.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "openfaas-token" {
+			t.Fatalf("want current token while the refresh backs off, got %q", got)
+		}
+	}
+
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("want no refresh retries during the backoff, got %d requests", n)
+	}
+}
+
+func Test_TokenAuth_StartRefresh(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "short lived token", body: `{"access_token":"openfaas-token","expires_in":5}`},
+		{name: "token without expiry", body: `{"access_token":"openfaas-token"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var exchanges atomic.Int32
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				exchanges.Add(1)
+
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, test.body)
+			}))
+			defer s.Close()
+
+			t.Setenv("TEST_ID_TOKEN", "id-token")
+			auth := &TokenAuth{
+				TokenURL:    s.URL,
+				TokenSource: &EnvTokenSource{Name: "TEST_ID_TOKEN"},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			auth.StartRefresh(ctx)
+
+			if n := exchanges.Load(); n != 1 {
+				t.Fatalf("want a single token exchange, got %d", n)
+			}
+		})
+	}
+}
+
+func Test_TokenAuth_TokenContextCancelled(t *testing.T) {
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"openfaas-token","expires_in":3600}`)
+	}))
+	defer s.Close()
+	defer close(release)
+
+	t.Setenv("TEST_ID_TOKEN", "id-token")
+	auth := &TokenAuth{
+		TokenURL:    s.URL,
+		TokenSource: &EnvTokenSource{Name: "TEST_ID_TOKEN"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := auth.TokenContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want context.DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSConfig configures the TLS settings of an http.Client.
+type TLSConfig struct {
+	// CAFile is the path to a PEM encoded CA bundle that is trusted
+	// in addition to the system roots.
+	CAFile string
+
+	// CertFile and KeyFile are the paths to a PEM encoded client certificate
+	// and key used for mutual TLS. The files are loaded again when they change
+	// so rotated certificates are picked up without a restart.
+	CertFile string
+	KeyFile  string
+
+	// ServerName overrides the name used to verify the server certificate.
+	ServerName string
+
+	// InsecureSkipVerify disables verification of the server certificate.
+	// It should only be used for development.
+	InsecureSkipVerify bool
+}
+
+// WithTLSConfig returns a copy of the http.Client with a transport that uses the TLS
+// configuration. The transport of the client must be nil or an *http.Transport. If the
+// configuration is invalid, requests made with the returned client fail with the error.
+func WithTLSConfig(client *http.Client, config *TLSConfig) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	decoratedClient := &http.Client{
+		CheckRedirect: client.CheckRedirect,
+		Jar:           client.Jar,
+		Timeout:       client.Timeout,
+	}
+
+	transport, err := tlsTransport(client.Transport, config)
+	if err != nil {
+		decoratedClient.Transport = errorTransport{err: err}
+		return decoratedClient
+	}
+
+	decoratedClient.Transport = transport
+	return decoratedClient
+}
+
+func tlsTransport(rt http.RoundTripper, config *TLSConfig) (*http.Transport, error) {
+	var transport *http.Transport
+	switch t := rt.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return nil, fmt.Errorf("TLS options can not be applied to transport of type %T, use an *http.Transport", rt)
+	}
+
+	tlsConfig := transport.TLSClientConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	if len(config.CAFile) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		data, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", config.CAFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(config.CertFile) > 0 || len(config.KeyFile) > 0 {
+		reloader := &certReloader{certFile: config.CertFile, keyFile: config.KeyFile}
+		if _, err := reloader.certificate(); err != nil {
+			return nil, err
+		}
+
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return reloader.certificate()
+		}
+	}
+
+	if len(config.ServerName) > 0 {
+		tlsConfig.ServerName = config.ServerName
+	}
+
+	if config.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// certReloader loads a client certificate and loads it again
+// when the certificate or key file is modified.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	lock        sync.Mutex // guards cert, certModTime and keyModTime
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+func (r *certReloader) certificate() (*tls.Certificate, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load client certificate: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load client key: %w", err)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.cert != nil && certInfo.ModTime().Equal(r.certModTime) && keyInfo.ModTime().Equal(r.keyModTime) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			// The files may be in the middle of being rotated,
+			// keep using the previous certificate.
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("unable to load client certificate: %w", err)
+	}
+
+	r.cert = &cert
+	r.certModTime = certInfo.ModTime()
+	r.keyModTime = keyInfo.ModTime()
+
+	return r.cert, nil
+}
+
+// errorTransport is an http.RoundTripper that fails each request with err.
+type errorTransport struct {
+	err error
+}
+
+func (t errorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, t.err
+}
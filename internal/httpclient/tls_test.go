@@ -0,0 +1,180 @@
+package httpclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_WithTLSConfig(t *testing.T) {
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			io.WriteString(w, "anonymous")
+			return
+		}
+		io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	s.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	s.StartTLS()
+	defer s.Close()
+
+	dir := t.TempDir()
+
+	caFile := filepath.Join(dir, "ca.crt")
+	writePEM(t, caFile, "CERTIFICATE", s.Certificate().Raw)
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	writeClientCertificate(t, certFile, keyFile, "client1")
+
+	get := func(t *testing.T, client *http.Client) (string, error) {
+		t.Helper()
+
+		res, err := client.Get(s.URL)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(res.Body)
+		return string(body), err
+	}
+
+	t.Run("server certificate is not trusted without CA bundle", func(t *testing.T) {
+		client := WithTLSConfig(nil, &TLSConfig{})
+		if _, err := get(t, client); err == nil {
+			t.Fatal("want certificate verification error")
+		}
+	})
+
+	t.Run("CA bundle", func(t *testing.T) {
+		client := WithTLSConfig(nil, &TLSConfig{CAFile: caFile})
+
+		got, err := get(t, client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "anonymous" {
+			t.Fatalf("want anonymous request, got %q", got)
+		}
+	})
+
+	t.Run("insecure skip verify", func(t *testing.T) {
+		client := WithTLSConfig(nil, &TLSConfig{InsecureSkipVerify: true})
+		if _, err := get(t, client); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("server name override", func(t *testing.T) {
+		// The httptest certificate is valid for example.com.
+		client := WithTLSConfig(nil, &TLSConfig{CAFile: caFile, ServerName: "example.com"})
+		if _, err := get(t, client); err != nil {
+			t.Fatal(err)
+		}
+
+		client = WithTLSConfig(nil, &TLSConfig{CAFile: caFile, ServerName: "gw.openfaas.dev"})
+		if _, err := get(t, client); err == nil {
+			t.Fatal("want error for server name that does not match the certificate")
+		}
+	})
+
+	t.Run("client certificate is reloaded after rotation", func(t *testing.T) {
+		client := WithTLSConfig(nil, &TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile})
+
+		got, err := get(t, client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "client1" {
+			t.Fatalf("want client certificate client1, got %q", got)
+		}
+
+		writeClientCertificate(t, certFile, keyFile, "client2")
+		future := time.Now().Add(time.Minute)
+		os.Chtimes(certFile, future, future)
+		os.Chtimes(keyFile, future, future)
+
+		// Force a new TLS handshake.
+		client.CloseIdleConnections()
+
+		got, err = get(t, client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "client2" {
+			t.Fatalf("want rotated client certificate client2, got %q", got)
+		}
+	})
+
+	t.Run("invalid CA bundle fails requests", func(t *testing.T) {
+		client := WithTLSConfig(nil, &TLSConfig{CAFile: filepath.Join(dir, "missing.crt")})
+
+		_, err := get(t, client)
+		if err == nil || !strings.Contains(err.Error(), "unable to read CA bundle") {
+			t.Fatalf("want CA bundle error, got: %v", err)
+		}
+	})
+
+	t.Run("custom transport is not supported", func(t *testing.T) {
+		client := WithTLSConfig(&http.Client{Transport: &FaasTransport{}}, &TLSConfig{InsecureSkipVerify: true})
+
+		_, err := get(t, client)
+		if err == nil || !strings.Contains(err.Error(), "TLS options can not be applied") {
+			t.Fatalf("want transport error, got: %v", err)
+		}
+	})
+}
+
+func writePEM(t *testing.T, path, blockType string, data []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeClientCertificate writes a self-signed client certificate and key with the common name.
+func writeClientCertificate(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "PRIVATE KEY", keyDER)
+}
@@ -0,0 +1,246 @@
+package sdk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// JSONWebKeySet is a set of public keys used to verify signed JWTs, as
+// published by the jwks_uri of an OIDC issuer.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JSONWebKey is a public key in the JWK format. RSA, EC (P-256, P-384 and P-521)
+// and OKP (Ed25519) keys are supported.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+
+	// RSA public key parameters.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC and OKP public key parameters.
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// ParseJSONWebKeySet parses a JSON Web Key Set document.
+func ParseJSONWebKeySet(data []byte) (*JSONWebKeySet, error) {
+	jwks := &JSONWebKeySet{}
+	if err := json.Unmarshal(data, jwks); err != nil {
+		return nil, fmt.Errorf("unable to parse JSON web key set: %w", err)
+	}
+
+	return jwks, nil
+}
+
+// PublicKey returns the public key for the JWK.
+func (k *JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key")
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// Key returns the key with the key ID. If kid is empty and the set
+// contains a single key, that key is returned.
+func (s *JSONWebKeySet) Key(kid string) (*JSONWebKey, bool) {
+	if len(kid) == 0 && len(s.Keys) == 1 {
+		return &s.Keys[0], true
+	}
+
+	for i := range s.Keys {
+		if s.Keys[i].Kid == kid {
+			return &s.Keys[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// ErrUnknownSigningKey is returned when a JWT is signed with a key
+// that is not in the JSON Web Key Set.
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// clockSkew is the leeway allowed when validating the exp and nbf claims.
+const clockSkew = 30 * time.Second
+
+// VerifyClaims verifies the signature of a JWT with the keys in the JSON Web Key Set,
+// checks that the token is not expired or used before its nbf time, and returns its
+// claims. The issuer and audience are not checked, they have to be validated by
+// the caller.
+func VerifyClaims(rawToken string, jwks *JSONWebKeySet) (*Claims, error) {
+	header, claims, err := decodeJWT(rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := jwks.Key(header.Kid)
+	if !ok {
+		return nil, fmt.Errorf("%w: kid %q", ErrUnknownSigningKey, header.Kid)
+	}
+
+	if len(key.Alg) > 0 && key.Alg != header.Alg {
+		return nil, fmt.Errorf("jwt alg %q does not match key alg %q", header.Alg, key.Alg)
+	}
+
+	pub, err := key.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	i := strings.LastIndex(rawToken, ".")
+	sig, err := base64.RawURLEncoding.DecodeString(rawToken[i+1:])
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt signature: %w", err)
+	}
+
+	if err := verifyJWTSignature(header.Alg, pub, []byte(rawToken[:i]), sig); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !claims.ExpiresAt.IsZero() && now.After(claims.ExpiresAt.Add(clockSkew)) {
+		return nil, fmt.Errorf("token expired at %s", claims.ExpiresAt.Format(time.RFC3339))
+	}
+	if !claims.NotBefore.IsZero() && now.Add(clockSkew).Before(claims.NotBefore) {
+		return nil, fmt.Errorf("token not valid before %s", claims.NotBefore.Format(time.RFC3339))
+	}
+
+	return claims, nil
+}
+
+// verifyJWTSignature verifies the JWS signature of the signing input with
+// the public key. The alg none is never accepted.
+func verifyJWTSignature(alg string, pub crypto.PublicKey, signingInput, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+	default:
+		return fmt.Errorf("unsupported jwt signing algorithm %q", alg)
+	}
+
+	var digest []byte
+	if hash != 0 {
+		h := hash.New()
+		h.Write(signingInput)
+		digest = h.Sum(nil)
+	}
+
+	invalid := fmt.Errorf("invalid jwt signature")
+
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		var err error
+		switch alg[:2] {
+		case "RS":
+			err = rsa.VerifyPKCS1v15(key, hash, digest, sig)
+		case "PS":
+			err = rsa.VerifyPSS(key, hash, digest, sig, nil)
+		default:
+			return fmt.Errorf("jwt alg %q can not be used with an RSA key", alg)
+		}
+		if err != nil {
+			return invalid
+		}
+	case *ecdsa.PublicKey:
+		curveAlg := map[int]string{256: "ES256", 384: "ES384", 521: "ES512"}[key.Curve.Params().BitSize]
+		if alg != curveAlg {
+			return fmt.Errorf("jwt alg %q can not be used with an EC key on curve %s", alg, key.Curve.Params().Name)
+		}
+
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return invalid
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return invalid
+		}
+	case ed25519.PublicKey:
+		if alg != "EdDSA" {
+			return fmt.Errorf("jwt alg %q can not be used with an Ed25519 key", alg)
+		}
+		if !ed25519.Verify(key, signingInput, sig) {
+			return invalid
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package sdk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// jwtExpiry returns the expiry time from the exp claim of a JWT without
+// verifying its signature. A zero time is returned if the token has no exp claim.
+func jwtExpiry(rawToken string) (time.Time, error) {
+	claims, err := ParseClaims(rawToken)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return claims.ExpiresAt, nil
+}
+
+// signJWT creates a JWT with the claims signed by signer. RSA keys are signed
+// with RS256, P-256 ECDSA keys with ES256 and Ed25519 keys with EdDSA.
+func signJWT(signer crypto.Signer, keyID string, claims map[string]any) (string, error) {
+	var alg string
+	var hash crypto.Hash
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		alg, hash = "RS256", crypto.SHA256
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return "", fmt.Errorf("unsupported ECDSA curve %s, only P-256 is supported", pub.Curve.Params().Name)
+		}
+		alg, hash = "ES256", crypto.SHA256
+	case ed25519.PublicKey:
+		alg = "EdDSA"
+	default:
+		return "", fmt.Errorf("unsupported signing key type %T", pub)
+	}
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if len(keyID) > 0 {
+		header["kid"] = keyID
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	digest := []byte(signingInput)
+	if hash != 0 {
+		h := hash.New()
+		h.Write(digest)
+		digest = h.Sum(nil)
+	}
+
+	sig, err := signer.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return "", fmt.Errorf("unable to sign jwt: %w", err)
+	}
+
+	if alg == "ES256" {
+		// ECDSA signers return an ASN.1 signature, JWS uses the
+		// fixed size concatenation of R and S.
+		var esig struct {
+			R, S *big.Int
+		}
+		if _, err := asn1.Unmarshal(sig, &esig); err != nil {
+			return "", fmt.Errorf("unable to parse ECDSA signature: %w", err)
+		}
+		sig = make([]byte, 64)
+		esig.R.FillBytes(sig[:32])
+		esig.S.FillBytes(sig[32:])
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
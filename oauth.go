@@ -0,0 +1,208 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// requestToken makes a request to an OAuth token endpoint with the
+// form values v. The ID token is returned if the endpoint issued one,
+// otherwise the access token is returned.
+func requestToken(ctx context.Context, client *http.Client, tokenURL string, v url.Values) (*Token, error) {
+	req, err := newTokenRequest(ctx, tokenURL, v)
+	if err != nil {
+		return nil, err
+	}
+
+	tj, err := doTokenRequest(client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &Token{
+		IDToken:      tj.AccessToken,
+		Expiry:       tj.expiry(),
+		Scope:        tj.scope(),
+		RefreshToken: tj.RefreshToken,
+	}
+
+	if len(tj.IDToken) > 0 {
+		token.IDToken = tj.IDToken
+		if exp, err := jwtExpiry(tj.IDToken); err == nil && !exp.IsZero() {
+			token.Expiry = exp
+		}
+	}
+
+	return token, nil
+}
+
+// newTokenRequest creates a form POST request for an OAuth token endpoint.
+func newTokenRequest(ctx context.Context, tokenURL string, v url.Values) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "openfaas-go-sdk")
+
+	return req, nil
+}
+
+// doTokenRequest sends a token request and parses the token response. An
+// *OAuthError is returned if the endpoint responds with an OAuth error.
+func doTokenRequest(client *http.Client, req *http.Request) (*tokenJSON, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch token: %v", err)
+	}
+
+	if res.StatusCode >= 400 && res.StatusCode < 500 {
+		authErr := &OAuthError{}
+		if err := json.Unmarshal(body, authErr); err == nil && len(authErr.Err) > 0 {
+			return nil, authErr
+		}
+	}
+
+	if code := res.StatusCode; code < 200 || code > 299 {
+		return nil, fmt.Errorf("unexpected status code: %v\nResponse: %s", res.Status, body)
+	}
+
+	tj := &tokenJSON{}
+	if err := json.Unmarshal(body, tj); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal token: %s", err)
+	}
+
+	return tj, nil
+}
+
+// refreshToken uses a refresh token to get a new token from the token endpoint.
+// The previous refresh token is kept if the endpoint does not rotate it.
+func refreshToken(ctx context.Context, client *http.Client, tokenURL, clientID, refreshToken string) (*Token, error) {
+	v := url.Values{}
+	v.Set("grant_type", "refresh_token")
+	v.Set("refresh_token", refreshToken)
+	if len(clientID) > 0 {
+		v.Set("client_id", clientID)
+	}
+
+	token, err := requestToken(ctx, client, tokenURL, v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(token.RefreshToken) == 0 {
+		token.RefreshToken = refreshToken
+	}
+
+	return token, nil
+}
+
+// refreshAccessToken uses a refresh token to get a new token from an OpenFaaS token
+// endpoint. Unlike refreshToken the access token is returned, as that is the token the
+// gateway accepts, even if the endpoint also issued an ID token.
+func refreshAccessToken(ctx context.Context, client *http.Client, tokenURL, refreshToken string) (*Token, error) {
+	v := url.Values{}
+	v.Set("grant_type", "refresh_token")
+	v.Set("refresh_token", refreshToken)
+
+	req, err := newTokenRequest(ctx, tokenURL, v)
+	if err != nil {
+		return nil, err
+	}
+
+	tj, err := doTokenRequest(client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	token := newAccessToken(tj)
+	if len(token.RefreshToken) == 0 {
+		token.RefreshToken = refreshToken
+	}
+
+	return token, nil
+}
+
+// interactiveSession caches the token of an interactive login and
+// refreshes it using the refresh token when it expires.
+type interactiveSession struct {
+	lock   sync.Mutex // guards token and loaded
+	token  *Token
+	loaded bool
+}
+
+// getToken returns a valid token from the session or the store. An expired
+// token is refreshed if it has a refresh token, otherwise login is called.
+func (s *interactiveSession) getToken(store TokenStore, refresh func(refreshToken string) (*Token, error), login func() (*Token, error)) (*Token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.loaded && store != nil {
+		token, err := store.Load()
+		if err != nil {
+			return nil, fmt.Errorf("unable to load token from store: %w", err)
+		}
+		s.token = token
+		s.loaded = true
+	}
+
+	if s.token != nil && !s.token.Expired() {
+		return s.token, nil
+	}
+
+	var token *Token
+	if s.token != nil && len(s.token.RefreshToken) > 0 {
+		// Fall back to an interactive login if the refresh token
+		// was revoked or has expired.
+		token, _ = refresh(s.token.RefreshToken)
+	}
+
+	if token == nil {
+		var err error
+		token, err = login()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if store != nil {
+		if err := store.Save(token); err != nil {
+			return nil, fmt.Errorf("unable to save token to store: %w", err)
+		}
+	}
+
+	s.token = token
+	return token, nil
+}
+
+// tokenWithContext gets a token from ts, passing on the context if ts
+// supports it.
+func tokenWithContext(ctx context.Context, ts TokenSource) (string, error) {
+	if cts, ok := ts.(interface {
+		TokenContext(ctx context.Context) (string, error)
+	}); ok {
+		return cts.TokenContext(ctx)
+	}
+
+	return ts.Token()
+}
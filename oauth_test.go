@@ -0,0 +1,319 @@
+package sdk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIdP is a minimal OAuth provider supporting the device authorization,
+// authorization code with PKCE and refresh token grants.
+type fakeIdP struct {
+	t *testing.T
+
+	lock          sync.Mutex
+	pendingPolls  int
+	challenges    map[string]string
+	refreshTokens map[string]bool
+	logins        int
+}
+
+func newFakeIdP(t *testing.T) *httptest.Server {
+	idp := &fakeIdP{
+		t:             t,
+		challenges:    map[string]string{},
+		refreshTokens: map[string]bool{"valid-refresh-token": true},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", idp.device)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+
+	return httptest.NewServer(mux)
+}
+
+func (idp *fakeIdP) device(w http.ResponseWriter, r *http.Request) {
+	if got := r.FormValue("client_id"); got != "cli" {
+		idp.t.Errorf("want client_id %q, got %q", "cli", got)
+	}
+
+	idp.lock.Lock()
+	idp.pendingPolls = 1
+	idp.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, DeviceAuthorization{
+		DeviceCode:      "device-code",
+		UserCode:        "ABCD-EFGH",
+		VerificationURI: "http://idp.example.com/device",
+		ExpiresIn:       30,
+		Interval:        1,
+	})
+}
+
+func (idp *fakeIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		idp.t.Errorf("want code_challenge_method S256, got %q", q.Get("code_challenge_method"))
+	}
+
+	idp.lock.Lock()
+	idp.challenges["auth-code"] = q.Get("code_challenge")
+	idp.lock.Unlock()
+
+	redirect, _ := url.Parse(q.Get("redirect_uri"))
+	rq := redirect.Query()
+	rq.Set("code", "auth-code")
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (idp *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	idp.lock.Lock()
+	defer idp.lock.Unlock()
+
+	switch r.FormValue("grant_type") {
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		if idp.pendingPolls > 0 {
+			idp.pendingPolls--
+			writeJSON(w, http.StatusBadRequest, OAuthError{Err: "authorization_pending"})
+			return
+		}
+		idp.logins++
+
+	case "authorization_code":
+		challenge := idp.challenges[r.FormValue("code")]
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if len(challenge) == 0 || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+			writeJSON(w, http.StatusBadRequest, OAuthError{Err: "invalid_grant", Description: "PKCE verification failed"})
+			return
+		}
+		idp.logins++
+
+	case "refresh_token":
+		if !idp.refreshTokens[r.FormValue("refresh_token")] {
+			writeJSON(w, http.StatusBadRequest, OAuthError{Err: "invalid_grant"})
+			return
+		}
+
+	default:
+		writeJSON(w, http.StatusBadRequest, OAuthError{Err: "unsupported_grant_type"})
+		return
+	}
+
+	idToken := newTestJWT(idp.t, map[string]any{
+		"sub": fmt.Sprintf("user-%s", r.FormValue("grant_type")),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token":  "access-token",
+		"id_token":      idToken,
+		"refresh_token": "valid-refresh-token",
+		"token_type":    "Bearer",
+		"expires_in":    300,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func Test_DeviceCodeTokenSource(t *testing.T) {
+	s := newFakeIdP(t)
+	defer s.Close()
+
+	prompted := false
+	ts := &DeviceCodeTokenSource{
+		ClientID:               "cli",
+		DeviceAuthorizationURL: s.URL + "/device",
+		TokenURL:               s.URL + "/token",
+		Scope:                  []string{"openid", "offline_access"},
+		Prompt: func(auth DeviceAuthorization) error {
+			prompted = true
+			if auth.UserCode != "ABCD-EFGH" {
+				t.Errorf("want user code %q, got %q", "ABCD-EFGH", auth.UserCode)
+			}
+			return nil
+		},
+	}
+
+	token, err := ts.ExpiringToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !prompted {
+		t.Fatal("want user to be prompted")
+	}
+	if token.RefreshToken != "valid-refresh-token" {
+		t.Fatalf("want refresh token to be set, got %q", token.RefreshToken)
+	}
+
+	exp, err := jwtExpiry(token.IDToken)
+	if err != nil || exp.IsZero() {
+		t.Fatalf("want the ID token to be returned, got %q", token.IDToken)
+	}
+}
+
+func Test_AuthorizationCodeTokenSource(t *testing.T) {
+	s := newFakeIdP(t)
+	defer s.Close()
+
+	store := &FileTokenStore{Path: path.Join(t.TempDir(), "token.json")}
+
+	ts := &AuthorizationCodeTokenSource{
+		ClientID:         "cli",
+		AuthorizationURL: s.URL + "/authorize",
+		TokenURL:         s.URL + "/token",
+		Scope:            []string{"openid"},
+		Store:            store,
+		Timeout:          10 * time.Second,
+		OpenBrowser: func(authURL string) error {
+			go func() {
+				res, err := http.Get(authURL)
+				if err != nil {
+					t.Errorf("browser request failed: %s", err)
+					return
+				}
+				res.Body.Close()
+				if res.StatusCode != http.StatusOK {
+					t.Errorf("want callback status 200, got %d", res.StatusCode)
+				}
+			}()
+			return nil
+		},
+	}
+
+	got, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil || stored.IDToken != got {
+		t.Fatalf("want token to be persisted in the store, got %v", stored)
+	}
+}
+
+func Test_AuthorizationCodeTokenSource_IgnoresInvalidState(t *testing.T) {
+	s := newFakeIdP(t)
+	defer s.Close()
+
+	ts := &AuthorizationCodeTokenSource{
+		ClientID:         "cli",
+		AuthorizationURL: s.URL + "/authorize",
+		TokenURL:         s.URL + "/token",
+		Timeout:          10 * time.Second,
+		OpenBrowser: func(authURL string) error {
+			u, err := url.Parse(authURL)
+			if err != nil {
+				return err
+			}
+			redirectURI := u.Query().Get("redirect_uri")
+
+			go func() {
+				// Requests with a missing or wrong state must not end the login.
+				for _, query := range []string{"", "?state=other&code=stolen", "?state=other&error=access_denied"} {
+					res, err := http.Get(redirectURI + query)
+					if err != nil {
+						t.Errorf("callback request failed: %s", err)
+						return
+					}
+					res.Body.Close()
+					if res.StatusCode != http.StatusBadRequest {
+						t.Errorf("want callback status 400 for %q, got %d", query, res.StatusCode)
+					}
+				}
+
+				res, err := http.Get(authURL)
+				if err != nil {
+					t.Errorf("browser request failed: %s", err)
+					return
+				}
+				res.Body.Close()
+				if res.StatusCode != http.StatusOK {
+					t.Errorf("want callback status 200, got %d", res.StatusCode)
+				}
+			}()
+			return nil
+		},
+	}
+
+	token, err := ts.Login(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token.IDToken) == 0 {
+		t.Fatal("want ID token after login")
+	}
+}
+
+func Test_InteractiveTokenSource_RefreshesStoredToken(t *testing.T) {
+	s := newFakeIdP(t)
+	defer s.Close()
+
+	store := &FileTokenStore{Path: path.Join(t.TempDir(), "token.json")}
+	if err := store.Save(&Token{
+		IDToken:      "expired-token",
+		Expiry:       time.Now().Add(-time.Hour),
+		RefreshToken: "valid-refresh-token",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := &DeviceCodeTokenSource{
+		ClientID:               "cli",
+		DeviceAuthorizationURL: s.URL + "/device",
+		TokenURL:               s.URL + "/token",
+		Store:                  store,
+		Prompt: func(auth DeviceAuthorization) error {
+			t.Fatal("user should not be prompted when a refresh token is available")
+			return nil
+		},
+	}
+
+	token, err := ts.ExpiringToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.IDToken == "expired-token" || token.Expired() {
+		t.Fatalf("want refreshed token, got %v", token)
+	}
+
+	stored, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.IDToken != token.IDToken {
+		t.Fatal("want refreshed token to be persisted in the store")
+	}
+}
+
+func Test_FileTokenStore_LoadMissing(t *testing.T) {
+	store := &FileTokenStore{Path: path.Join(t.TempDir(), "missing.json")}
+
+	token, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != nil {
+		t.Fatalf("want nil token, got %v", token)
+	}
+}
@@ -1,48 +1,77 @@
 package sdk
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // ReadSecrets reads a single secrets from /var/openfaas/secrets or from
 // the environment "secret_mount_path" if set.
 func ReadSecret(key string) (string, error) {
+	secretBytes, err := ReadSecretBytes(key)
+	if err != nil {
+		return "", err
+	}
 
+	val := strings.TrimSpace(string(secretBytes))
+	return val, nil
+}
+
+// ReadSecretBytes reads the raw content of a single secret from /var/openfaas/secrets
+// or from the environment "secret_mount_path" if set. Unlike ReadSecret, whitespace
+// is not trimmed so binary secrets such as keystores are returned unmodified.
+func ReadSecretBytes(key string) ([]byte, error) {
 	readPath := getPath(key)
 	secretBytes, readErr := os.ReadFile(readPath)
 	if readErr != nil {
-		return "", fmt.Errorf("unable to read secret: %s, error: %s", readPath, readErr)
+		return nil, fmt.Errorf("unable to read secret: %s, error: %s", readPath, readErr)
 	}
-	val := strings.TrimSpace(string(secretBytes))
-	return val, nil
+	return secretBytes, nil
 }
 
 // ReadSecrets reads all secrets from /var/openfaas/secrets or from
 // the environment "secret_mount_path" if set.
 // The results are returned in a map of key/value pairs.
 func ReadSecrets() (SecretMap, error) {
+	raw, err := readSecretValues(getPath(""))
+	if err != nil {
+		return newSecretMap(map[string]string{}), err
+	}
+
+	return newSecretMapFromRaw(raw), nil
+}
 
-	values := map[string]string{}
-	secretMap := newSecretMap(values)
-	base := getPath("")
+// readSecretValues reads the raw content of every secret file in base. Hidden
+// entries such as the "..data" symlink and timestamped directories that Kubernetes
+// uses for atomic updates of a secret volume are skipped.
+func readSecretValues(base string) (map[string][]byte, error) {
+	raw := map[string][]byte{}
 
 	files, err := os.ReadDir(base)
 	if err != nil {
-		return secretMap, err
+		return raw, err
 	}
 
 	for _, file := range files {
-		val, err := ReadSecret(file.Name())
+		if strings.HasPrefix(file.Name(), "..") || file.IsDir() {
+			continue
+		}
+
+		readPath := path.Join(base, file.Name())
+		secretBytes, err := os.ReadFile(readPath)
 		if err != nil {
-			return secretMap, err
+			return raw, fmt.Errorf("unable to read secret: %s, error: %s", readPath, err)
 		}
-		values[file.Name()] = val
+		raw[file.Name()] = secretBytes
 	}
 
-	return secretMap, nil
+	return raw, nil
 }
 
 func newSecretMap(values map[string]string) SecretMap {
@@ -51,6 +80,18 @@ func newSecretMap(values map[string]string) SecretMap {
 	}
 }
 
+func newSecretMapFromRaw(raw map[string][]byte) SecretMap {
+	values := make(map[string]string, len(raw))
+	for key, val := range raw {
+		values[key] = strings.TrimSpace(string(val))
+	}
+
+	return SecretMap{
+		values: values,
+		raw:    raw,
+	}
+}
+
 func getPath(key string) string {
 	basePath := "/var/openfaas/secrets/"
 	if len(os.Getenv("secret_mount_path")) > 0 {
@@ -59,19 +100,136 @@ func getPath(key string) string {
 	return path.Join(basePath, key)
 }
 
+// SecretMap is a queryable map of secrets. Get and the typed accessors return
+// values with surrounding whitespace trimmed, use GetBytes for the raw content.
 type SecretMap struct {
 	values map[string]string
+	raw    map[string][]byte
 }
 
 func (s *SecretMap) Get(key string) (string, error) {
 	val, ok := s.values[key]
 	if !ok {
-		return "", fmt.Errorf("secret %s not found", key)
+		return "", fmt.Errorf("secret %s %w", key, ErrNotFound)
 	}
 	return val, nil
 }
 
+// GetOrDefault returns the value of the secret or defaultVal if the secret does not exist.
+func (s *SecretMap) GetOrDefault(key, defaultVal string) string {
+	if val, ok := s.values[key]; ok {
+		return val
+	}
+	return defaultVal
+}
+
+// GetBytes returns the raw content of the secret without trimming whitespace.
+func (s *SecretMap) GetBytes(key string) ([]byte, error) {
+	if val, ok := s.raw[key]; ok {
+		return val, nil
+	}
+
+	val, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(val), nil
+}
+
 func (s *SecretMap) Exists(key string) bool {
 	_, ok := s.values[key]
 	return ok
 }
+
+// Keys returns the sorted names of all secrets in the map.
+func (s *SecretMap) Keys() []string {
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// GetInt returns the value of the secret parsed as an int.
+func (s *SecretMap) GetInt(key string) (int, error) {
+	val, err := s.Get(key)
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse secret %s as int: %w", key, err)
+	}
+	return i, nil
+}
+
+// GetIntOrDefault returns the value of the secret parsed as an int or defaultVal
+// if the secret does not exist.
+func (s *SecretMap) GetIntOrDefault(key string, defaultVal int) (int, error) {
+	if !s.Exists(key) {
+		return defaultVal, nil
+	}
+	return s.GetInt(key)
+}
+
+// GetBool returns the value of the secret parsed with strconv.ParseBool.
+func (s *SecretMap) GetBool(key string) (bool, error) {
+	val, err := s.Get(key)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("unable to parse secret %s as bool: %w", key, err)
+	}
+	return b, nil
+}
+
+// GetBoolOrDefault returns the value of the secret parsed as a bool or defaultVal
+// if the secret does not exist.
+func (s *SecretMap) GetBoolOrDefault(key string, defaultVal bool) (bool, error) {
+	if !s.Exists(key) {
+		return defaultVal, nil
+	}
+	return s.GetBool(key)
+}
+
+// GetDuration returns the value of the secret parsed with time.ParseDuration.
+func (s *SecretMap) GetDuration(key string) (time.Duration, error) {
+	val, err := s.Get(key)
+	if err != nil {
+		return 0, err
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse secret %s as duration: %w", key, err)
+	}
+	return d, nil
+}
+
+// GetDurationOrDefault returns the value of the secret parsed as a duration or defaultVal
+// if the secret does not exist.
+func (s *SecretMap) GetDurationOrDefault(key string, defaultVal time.Duration) (time.Duration, error) {
+	if !s.Exists(key) {
+		return defaultVal, nil
+	}
+	return s.GetDuration(key)
+}
+
+// GetJSON unmarshals the JSON content of the secret into v.
+func (s *SecretMap) GetJSON(key string, v any) error {
+	data, err := s.GetBytes(key)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("unable to unmarshal secret %s: %w", key, err)
+	}
+	return nil
+}
@@ -1,9 +1,11 @@
 package sdk
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	cmp "github.com/google/go-cmp/cmp"
 )
@@ -102,3 +104,112 @@ func Test_SecretMap_GetValue_NotFound(t *testing.T) {
 	}
 
 }
+
+func Test_ReadSecrets_PreservesBinaryContent(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("secret_mount_path", tmpDir)
+
+	value := []byte{0x00, 0x0a, 0x20, 0xff, 0x0a}
+	if err := os.WriteFile(tmpDir+"/keystore", value, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ReadSecretBytes("keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(value, raw) {
+		t.Fatalf("want %v, but got %v", value, raw)
+	}
+
+	secrets, err := ReadSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := secrets.GetBytes("keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(value, got) {
+		t.Fatalf("want %v, but got %v", value, got)
+	}
+}
+
+func Test_SecretMap_Keys(t *testing.T) {
+	m := newSecretMap(map[string]string{"b": "2", "a": "1", "c": "3"})
+
+	want := []string{"a", "b", "c"}
+	if got := m.Keys(); !cmp.Equal(want, got) {
+		t.Fatalf("want %v, but got %v", want, got)
+	}
+}
+
+func Test_SecretMap_TypedAccessors(t *testing.T) {
+	m := newSecretMap(map[string]string{
+		"port":    "8080",
+		"debug":   "true",
+		"timeout": "10s",
+		"config":  `{"user":"admin","retries":3}`,
+		"invalid": "not-a-number",
+	})
+
+	if got, err := m.GetInt("port"); err != nil || got != 8080 {
+		t.Fatalf("want 8080, but got %d, error: %v", got, err)
+	}
+
+	if got, err := m.GetBool("debug"); err != nil || !got {
+		t.Fatalf("want true, but got %v, error: %v", got, err)
+	}
+
+	if got, err := m.GetDuration("timeout"); err != nil || got != 10*time.Second {
+		t.Fatalf("want 10s, but got %s, error: %v", got, err)
+	}
+
+	var config struct {
+		User    string `json:"user"`
+		Retries int    `json:"retries"`
+	}
+	if err := m.GetJSON("config", &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.User != "admin" || config.Retries != 3 {
+		t.Fatalf("unexpected config: %+v", config)
+	}
+
+	if _, err := m.GetInt("invalid"); err == nil {
+		t.Fatal("want error for invalid int")
+	}
+
+	if _, err := m.GetInt("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("want ErrNotFound, but got %v", err)
+	}
+}
+
+func Test_SecretMap_Defaults(t *testing.T) {
+	m := newSecretMap(map[string]string{"port": "8080", "invalid": "x"})
+
+	if got := m.GetOrDefault("user", "admin"); got != "admin" {
+		t.Fatalf("want admin, but got %s", got)
+	}
+
+	if got, err := m.GetIntOrDefault("port", 80); err != nil || got != 8080 {
+		t.Fatalf("want 8080, but got %d, error: %v", got, err)
+	}
+
+	if got, err := m.GetIntOrDefault("workers", 4); err != nil || got != 4 {
+		t.Fatalf("want 4, but got %d, error: %v", got, err)
+	}
+
+	if got, err := m.GetBoolOrDefault("debug", true); err != nil || !got {
+		t.Fatalf("want true, but got %v, error: %v", got, err)
+	}
+
+	if got, err := m.GetDurationOrDefault("timeout", time.Minute); err != nil || got != time.Minute {
+		t.Fatalf("want 1m, but got %s, error: %v", got, err)
+	}
+
+	if _, err := m.GetIntOrDefault("invalid", 1); err == nil {
+		t.Fatal("want error for invalid value of existing secret")
+	}
+}
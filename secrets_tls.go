@@ -0,0 +1,114 @@
+package sdk
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// GetCertificates parses all PEM encoded certificates in the secret.
+func (s *SecretMap) GetCertificates(key string) ([]*x509.Certificate, error) {
+	data, err := s.GetBytes(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse certificate in secret %s: %w", key, err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM encoded certificates found in secret %s", key)
+	}
+
+	return certs, nil
+}
+
+// GetPrivateKey parses a PEM encoded PKCS #8, PKCS #1 or EC private key from the secret.
+func (s *SecretMap) GetPrivateKey(key string) (crypto.PrivateKey, error) {
+	data, err := s.GetBytes(key)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no PEM encoded private key found in secret %s", key)
+		}
+
+		switch block.Type {
+		case "PRIVATE KEY":
+			return x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		}
+	}
+}
+
+// GetTLSConfig builds a tls.Config from PEM encoded secrets.
+//
+// Parameters:
+//   - certKey: name of the secret containing the certificate chain, may be empty.
+//   - keyKey: name of the secret containing the private key for the certificate.
+//   - caKey: name of the secret containing the CA bundle used to verify peers, may be empty.
+//
+// The CA bundle is used for both RootCAs and ClientCAs so the config can be used for
+// clients and for servers that verify client certificates.
+func (s *SecretMap) GetTLSConfig(certKey, keyKey, caKey string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if len(certKey) > 0 {
+		certPEM, err := s.GetBytes(certKey)
+		if err != nil {
+			return nil, err
+		}
+		keyPEM, err := s.GetBytes(keyKey)
+		if err != nil {
+			return nil, err
+		}
+
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load key pair from secrets %s and %s: %w", certKey, keyKey, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(caKey) > 0 {
+		caPEM, err := s.GetBytes(caKey)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no PEM encoded certificates found in secret %s", caKey)
+		}
+		config.RootCAs = pool
+		config.ClientCAs = pool
+	}
+
+	return config, nil
+}
@@ -0,0 +1,90 @@
+package sdk
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func Test_SecretMap_GetTLSConfig(t *testing.T) {
+	certPEM, keyPEM := generateTestCertificate(t)
+
+	m := newSecretMapFromRaw(map[string][]byte{
+		"tls.crt": certPEM,
+		"tls.key": keyPEM,
+		"ca.crt":  certPEM,
+	})
+
+	certs, err := m.GetCertificates("tls.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 || certs[0].Subject.CommonName != "openfaas-test" {
+		t.Fatalf("unexpected certificates: %v", certs)
+	}
+
+	key, err := m.GetPrivateKey("tls.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := key.(*ecdsa.PrivateKey); !ok {
+		t.Fatalf("want *ecdsa.PrivateKey, but got %T", key)
+	}
+
+	config, err := m.GetTLSConfig("tls.crt", "tls.key", "ca.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Certificates) != 1 {
+		t.Fatalf("want 1 certificate, but got %d", len(config.Certificates))
+	}
+	if config.RootCAs == nil {
+		t.Fatal("want RootCAs to be set")
+	}
+
+	if _, err := m.GetTLSConfig("tls.crt", "ca.crt", ""); err == nil {
+		t.Fatal("want error for mismatched key pair")
+	}
+}
+
+func generateTestCertificate(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "openfaas-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:              []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM
+}
@@ -0,0 +1,221 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretChange describes the keys that changed between two reads of the
+// secrets mount path.
+type SecretChange struct {
+	Added   []string
+	Updated []string
+	Removed []string
+}
+
+// WatchedSecretMap is a SecretMap that can be refreshed when the files in
+// /var/openfaas/secrets, or the path set by the environment "secret_mount_path",
+// change. It is safe for concurrent use.
+//
+// Kubernetes updates secret volumes by atomically swapping the "..data" symlink
+// to a new timestamped directory. Both the symlink target and the size and
+// modification time of each file are checked, so rotations are detected for
+// Kubernetes secret volumes as well as plain directories.
+type WatchedSecretMap struct {
+	basePath string
+
+	// reloadLock serializes reloads, so a snapshot is never replaced by an
+	// older one and each change is reported once.
+	reloadLock sync.Mutex
+
+	lock        sync.RWMutex // guards secrets and fingerprint
+	secrets     SecretMap
+	fingerprint string
+
+	callbacksLock sync.Mutex
+	callbacks     []func(SecretChange)
+}
+
+// NewWatchedSecretMap reads all secrets from /var/openfaas/secrets or from
+// the environment "secret_mount_path" if set, and returns a map that can be
+// kept up to date by calling Watch.
+func NewWatchedSecretMap() (*WatchedSecretMap, error) {
+	m := &WatchedSecretMap{
+		basePath: getPath(""),
+	}
+
+	if _, err := m.Reload(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Get returns the current value of the secret with the given key.
+func (m *WatchedSecretMap) Get(key string) (string, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.secrets.Get(key)
+}
+
+// Exists reports whether a secret with the given key is currently available.
+func (m *WatchedSecretMap) Exists(key string) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.secrets.Exists(key)
+}
+
+// Secrets returns a point-in-time snapshot of the secrets. The snapshot is not
+// updated when the secrets change.
+func (m *WatchedSecretMap) Secrets() SecretMap {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.secrets
+}
+
+// OnChange registers a callback that is invoked after a reload in which at least
+// one secret was added, updated or removed.
+func (m *WatchedSecretMap) OnChange(fn func(SecretChange)) {
+	m.callbacksLock.Lock()
+	defer m.callbacksLock.Unlock()
+
+	m.callbacks = append(m.callbacks, fn)
+}
+
+// Watch polls the secrets mount path for changes at the given interval and
+// reloads the secrets when a change is detected. Watch blocks until the context
+// is cancelled. Errors while reloading are ignored and the previous values are
+// kept until a later poll succeeds.
+func (m *WatchedSecretMap) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+
+	for {
+		select {
+		case <-ticker.C:
+			m.Reload()
+		case <-ctx.Done():
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// Reload re-reads the secrets if the mount path has changed since the last read.
+// The returned bool reports whether the secrets were re-read. Concurrent calls are
+// serialized, callbacks registered with OnChange must not call Reload.
+func (m *WatchedSecretMap) Reload() (bool, error) {
+	m.reloadLock.Lock()
+	defer m.reloadLock.Unlock()
+
+	fingerprint, err := secretsFingerprint(m.basePath)
+	if err != nil {
+		return false, err
+	}
+
+	m.lock.RLock()
+	unchanged := m.secrets.values != nil && fingerprint == m.fingerprint
+	m.lock.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	raw, err := readSecretValues(m.basePath)
+	if err != nil {
+		return false, err
+	}
+
+	m.lock.Lock()
+	previous := m.secrets.raw
+	m.secrets = newSecretMapFromRaw(raw)
+	m.fingerprint = fingerprint
+	m.lock.Unlock()
+
+	if previous == nil {
+		return true, nil
+	}
+
+	change := diffSecrets(previous, raw)
+	if len(change.Added) > 0 || len(change.Updated) > 0 || len(change.Removed) > 0 {
+		m.callbacksLock.Lock()
+		callbacks := append([]func(SecretChange){}, m.callbacks...)
+		m.callbacksLock.Unlock()
+
+		for _, fn := range callbacks {
+			fn(change)
+		}
+	}
+
+	return true, nil
+}
+
+// secretsFingerprint returns a string that changes whenever the target of the
+// "..data" symlink, or the name, size or modification time of a secret changes.
+func secretsFingerprint(base string) (string, error) {
+	files, err := os.ReadDir(base)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if target, err := os.Readlink(path.Join(base, "..data")); err == nil {
+		sb.WriteString(target)
+		sb.WriteString("\n")
+	}
+
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), "..") || file.IsDir() {
+			continue
+		}
+
+		// Stat follows symlinks so the fingerprint reflects the file content
+		// the link currently points to.
+		info, err := os.Stat(path.Join(base, file.Name()))
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteString(fmt.Sprintf("%s:%d:%d\n", file.Name(), info.Size(), info.ModTime().UnixNano()))
+	}
+
+	return sb.String(), nil
+}
+
+func diffSecrets(previous, current map[string][]byte) SecretChange {
+	change := SecretChange{}
+
+	for key, val := range current {
+		prev, ok := previous[key]
+		if !ok {
+			change.Added = append(change.Added, key)
+		} else if !bytes.Equal(prev, val) {
+			change.Updated = append(change.Updated, key)
+		}
+	}
+
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			change.Removed = append(change.Removed, key)
+		}
+	}
+
+	sort.Strings(change.Added)
+	sort.Strings(change.Updated)
+	sort.Strings(change.Removed)
+
+	return change
+}
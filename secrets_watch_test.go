@@ -0,0 +1,228 @@
+package sdk
+
+import (
+	"context"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	cmp "github.com/google/go-cmp/cmp"
+)
+
+func Test_WatchedSecretMap_ReloadOnFileChange(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("secret_mount_path", tmpDir)
+
+	if err := os.WriteFile(path.Join(tmpDir, "api-key"), []byte("key1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(tmpDir, "old-key"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewWatchedSecretMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []SecretChange
+	m.OnChange(func(change SecretChange) {
+		got = append(got, change)
+	})
+
+	if reloaded, err := m.Reload(); err != nil || reloaded {
+		t.Fatalf("want no reload without changes, got reloaded: %v, err: %v", reloaded, err)
+	}
+
+	if err := os.WriteFile(path.Join(tmpDir, "api-key"), []byte("rotated-key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(tmpDir, "new-key"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path.Join(tmpDir, "old-key")); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := m.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded {
+		t.Fatal("want secrets to be reloaded")
+	}
+
+	val, err := m.Get("api-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "rotated-key" {
+		t.Fatalf("want %s, but got %s", "rotated-key", val)
+	}
+
+	if m.Exists("old-key") {
+		t.Fatal("old-key should not exist")
+	}
+
+	want := []SecretChange{{
+		Added:   []string{"new-key"},
+		Updated: []string{"api-key"},
+		Removed: []string{"old-key"},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("change mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_WatchedSecretMap_KubernetesSymlinkSwap(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("secret_mount_path", tmpDir)
+
+	writeVersion := func(name, value string) {
+		t.Helper()
+		dir := path.Join(tmpDir, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(dir, "api-key"), []byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Swap the ..data symlink atomically in the same way as the kubelet.
+		tmpLink := path.Join(tmpDir, "..data_tmp")
+		if err := os.Symlink(name, tmpLink); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmpLink, path.Join(tmpDir, "..data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeVersion("..2024_01_01", "value1")
+	if err := os.Symlink("..data/api-key", path.Join(tmpDir, "api-key")); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewWatchedSecretMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if val, _ := m.Get("api-key"); val != "value1" {
+		t.Fatalf("want %s, but got %s", "value1", val)
+	}
+
+	if len(m.Secrets().values) != 1 {
+		t.Fatalf("want 1 secret, but got %d", len(m.Secrets().values))
+	}
+
+	changed := make(chan SecretChange, 1)
+	m.OnChange(func(change SecretChange) {
+		changed <- change
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Watch(ctx, 10*time.Millisecond)
+
+	writeVersion("..2024_01_02", "value2")
+
+	select {
+	case change := <-changed:
+		if diff := cmp.Diff([]string{"api-key"}, change.Updated); diff != "" {
+			t.Fatalf("updated keys mismatch (-want +got):\n%s", diff)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for secret change")
+	}
+
+	if val, _ := m.Get("api-key"); val != "value2" {
+		t.Fatalf("want %s, but got %s", "value2", val)
+	}
+}
+
+func Test_WatchedSecretMap_ConcurrentAccess(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("secret_mount_path", tmpDir)
+
+	if err := os.WriteFile(path.Join(tmpDir, "api-key"), []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewWatchedSecretMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.Get("api-key")
+				m.Exists("api-key")
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			os.WriteFile(path.Join(tmpDir, "api-key"), []byte(time.Now().String()), 0644)
+			m.Reload()
+		}(i)
+	}
+	wg.Wait()
+}
+
+func Test_WatchedSecretMap_ConcurrentReload(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("secret_mount_path", tmpDir)
+
+	if err := os.WriteFile(path.Join(tmpDir, "api-key"), []byte("key1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewWatchedSecretMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		lock    sync.Mutex
+		changes int
+	)
+	m.OnChange(func(change SecretChange) {
+		lock.Lock()
+		changes++
+		lock.Unlock()
+	})
+
+	if err := os.WriteFile(path.Join(tmpDir, "api-key"), []byte("rotated-key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.Reload(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if changes != 1 {
+		t.Fatalf("want change to be reported once, got %d", changes)
+	}
+
+	val, err := m.Get("api-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "rotated-key" {
+		t.Fatalf("want rotated-key, got %s", val)
+	}
+}
@@ -24,6 +24,10 @@ type Token struct {
 
 	// Scope is the scope of the access token
 	Scope []string
+
+	// RefreshToken is used to obtain a new token once it expires.
+	// It is only set if the token endpoint returned a refresh token.
+	RefreshToken string
 }
 
 // Expired reports whether the token is expired, and will start
@@ -38,8 +42,10 @@ func (t *Token) Expired() bool {
 
 // tokenJson represents an OAuth token response
 type tokenJSON struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	IDToken      string `json:"id_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
 
 	ExpiresIn int    `json:"expires_in"`
 	Scope     string `json:"scope"`
@@ -0,0 +1,111 @@
+package sdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TokenStore persists the token obtained by an interactive login
+// so users don't have to log in again each time a program is started.
+type TokenStore interface {
+	// Load returns the stored token or nil if no token has been stored.
+	Load() (*Token, error)
+
+	// Save stores the token, replacing any previously stored token.
+	Save(token *Token) error
+}
+
+// FileTokenStore stores a token as JSON in a file that is
+// only readable by the current user.
+type FileTokenStore struct {
+	// Path of the file used to store the token.
+	Path string
+}
+
+// storedToken is the on-disk format of a Token.
+type storedToken struct {
+	IDToken      string    `json:"id_token"`
+	Expiry       time.Time `json:"expiry,omitzero"`
+	Scope        []string  `json:"scope,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+}
+
+// Load reads the token from the file. A nil token is returned if the file does not exist.
+func (s *FileTokenStore) Load() (*Token, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := unmarshalToken(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal token from %s: %w", s.Path, err)
+	}
+
+	return token, nil
+}
+
+// Save writes the token to a file that is only readable by the current user.
+func (s *FileTokenStore) Save(token *Token) error {
+	data, err := marshalToken(token)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.Path, data)
+}
+
+// writeFileAtomic writes data to a temporary file that is renamed to path,
+// so a partially written file is never read. The file is only readable by
+// the current user.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func marshalToken(token *Token) ([]byte, error) {
+	return json.Marshal(storedToken{
+		IDToken:      token.IDToken,
+		Expiry:       token.Expiry,
+		Scope:        token.Scope,
+		RefreshToken: token.RefreshToken,
+	})
+}
+
+func unmarshalToken(data []byte) (*Token, error) {
+	st := storedToken{}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+
+	return &Token{
+		IDToken:      st.IDToken,
+		Expiry:       st.Expiry,
+		Scope:        st.Scope,
+		RefreshToken: st.RefreshToken,
+	}, nil
+}
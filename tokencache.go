@@ -3,6 +3,7 @@ package sdk
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,6 +17,9 @@ type MemoryTokenCache struct {
 	tokens map[string]*Token
 
 	lock sync.RWMutex
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
 }
 
 // NewMemoryTokenCache creates a new in memory token cache instance.
@@ -42,15 +46,39 @@ func (c *MemoryTokenCache) Get(key string) (*Token, bool) {
 
 	if ok && token.Expired() {
 		c.lock.Lock()
-		delete(c.tokens, key)
+		// Only delete the token if it was not replaced by
+		// a concurrent Set after the read lock was released.
+		if current, ok := c.tokens[key]; ok && current == token {
+			delete(c.tokens, key)
+		}
 		c.lock.Unlock()
 
+		c.misses.Add(1)
 		return nil, false
 	}
 
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+
 	return token, ok
 }
 
+// Stats returns the hit and miss counters and the current size of the cache.
+func (c *MemoryTokenCache) Stats() TokenCacheStats {
+	c.lock.RLock()
+	size := len(c.tokens)
+	c.lock.RUnlock()
+
+	return TokenCacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Size:   size,
+	}
+}
+
 // StartGC starts garbage collection of expired tokens.
 func (c *MemoryTokenCache) StartGC(ctx context.Context, gcInterval time.Duration) {
 	if gcInterval <= 0 {
@@ -72,11 +100,74 @@ func (c *MemoryTokenCache) StartGC(ctx context.Context, gcInterval time.Duration
 
 // clearExpired removes all expired tokens from the cache.
 func (c *MemoryTokenCache) clearExpired() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	for key, token := range c.tokens {
 		if token.Expired() {
-			c.lock.Lock()
 			delete(c.tokens, key)
-			c.lock.Unlock()
 		}
 	}
 }
+
+// TokenCacheStats contains counters for a token cache.
+type TokenCacheStats struct {
+	// Hits is the number of lookups that returned a valid token.
+	Hits uint64
+
+	// Misses is the number of lookups for missing or expired tokens.
+	Misses uint64
+
+	// Evictions is the number of valid tokens removed to make room for new tokens.
+	Evictions uint64
+
+	// Exchanges is the number of token exchanges made to fill the cache.
+	// It is only set by Client.FunctionTokenStats.
+	Exchanges uint64
+
+	// Size is the number of tokens in the cache.
+	Size int
+}
+
+// exchangeGroup deduplicates concurrent token exchanges for the same key,
+// so callers that miss the cache at the same time share one exchange.
+type exchangeGroup struct {
+	lock      sync.Mutex // guards calls
+	calls     map[string]*tokenCall
+	exchanges atomic.Uint64
+}
+
+// do calls exchange for the key unless an exchange for the key is already in
+// flight, in which case it waits for that exchange and returns its result.
+// The exchange is not cancelled when ctx is cancelled, as other callers may
+// be waiting for it, but do returns early with the context error.
+func (g *exchangeGroup) do(ctx context.Context, key string, exchange func(ctx context.Context) (*Token, error)) (*Token, error) {
+	g.lock.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*tokenCall{}
+	}
+
+	call, ok := g.calls[key]
+	if !ok {
+		call = &tokenCall{done: make(chan struct{})}
+		g.calls[key] = call
+		g.exchanges.Add(1)
+
+		go func() {
+			call.token, call.err = exchange(context.WithoutCancel(ctx))
+
+			g.lock.Lock()
+			delete(g.calls, key)
+			g.lock.Unlock()
+			close(call.done)
+		}()
+	}
+	g.lock.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,169 @@
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/openfaas/go-sdk/seal"
+)
+
+// FileTokenCache is a TokenCache that persists tokens to a file so they survive
+// restarts. Tokens are encrypted at rest with a keypair from the seal package.
+//
+// The file is re-read when it was changed by another process, so replicas
+// sharing a volume can re-use each other's tokens.
+//
+// Errors reading or writing the file are reported to the OnError callback
+// if set. The in-memory tokens keep being used when the file can't be accessed.
+type FileTokenCache struct {
+	path       string
+	publicKey  []byte
+	privateKey []byte
+
+	// OnError is called with errors reading or writing the cache file. Optional.
+	OnError func(err error)
+
+	lock    sync.Mutex // guards tokens and modTime
+	tokens  map[string]*Token
+	modTime time.Time
+}
+
+// NewFileTokenCache creates a token cache persisted to path. The keys must be a
+// base64-encoded keypair as returned by seal.GenerateKeyPair. Existing tokens are
+// loaded from the file if it exists.
+func NewFileTokenCache(path string, publicKey, privateKey []byte) (*FileTokenCache, error) {
+	c := &FileTokenCache{
+		path:       path,
+		publicKey:  publicKey,
+		privateKey: privateKey,
+		tokens:     map[string]*Token{},
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Set adds or updates a token with the given key and writes the cache to disk.
+// Expired tokens are removed from the file when it is written.
+func (c *FileTokenCache) Set(key string, token *Token) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// Merge changes made by other processes before writing.
+	if err := c.load(); err != nil {
+		c.reportError(err)
+	}
+
+	c.tokens[key] = token
+	if err := c.save(); err != nil {
+		c.reportError(err)
+	}
+}
+
+// Get retrieves the token associated with the given key from the cache. The bool
+// return value will be false if no matching key is found, and true otherwise.
+func (c *FileTokenCache) Get(key string) (*Token, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	token, ok := c.tokens[key]
+	if !ok || token.Expired() {
+		if err := c.load(); err != nil {
+			c.reportError(err)
+		}
+		token, ok = c.tokens[key]
+	}
+
+	if !ok || token.Expired() {
+		return nil, false
+	}
+
+	return token, true
+}
+
+// load reads the tokens from the file if it was modified since the last read.
+// The caller must hold c.lock.
+func (c *FileTokenCache) load() error {
+	info, err := os.Stat(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.ModTime().Equal(c.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+
+	values, err := seal.Unseal(c.privateKey, data)
+	if err != nil {
+		return fmt.Errorf("unable to unseal token cache %s: %w", c.path, err)
+	}
+
+	for key, value := range values {
+		token, err := unmarshalToken(value)
+		if err != nil {
+			return fmt.Errorf("unable to unmarshal token %s from cache %s: %w", key, c.path, err)
+		}
+		if !token.Expired() {
+			c.tokens[key] = token
+		}
+	}
+
+	c.modTime = info.ModTime()
+	return nil
+}
+
+// save seals all valid tokens and writes them to the file.
+// The caller must hold c.lock.
+func (c *FileTokenCache) save() error {
+	values := make(map[string][]byte, len(c.tokens))
+	for key, token := range c.tokens {
+		if token.Expired() {
+			delete(c.tokens, key)
+			continue
+		}
+
+		data, err := marshalToken(token)
+		if err != nil {
+			return err
+		}
+		values[key] = data
+	}
+
+	sealed, err := seal.Seal(c.publicKey, values)
+	if err != nil {
+		return fmt.Errorf("unable to seal token cache: %w", err)
+	}
+
+	if err := writeFileAtomic(c.path, sealed); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(c.path); err == nil {
+		c.modTime = info.ModTime()
+	}
+
+	return nil
+}
+
+func (c *FileTokenCache) reportError(err error) {
+	if c.OnError != nil {
+		c.OnError(err)
+	}
+}
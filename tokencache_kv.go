@@ -0,0 +1,92 @@
+package sdk
+
+import (
+	"time"
+)
+
+// KeyValueStore is implemented by external key/value stores, i.e. a Redis
+// client, so they can be used as a shared TokenCache with NewKeyValueTokenCache.
+type KeyValueStore interface {
+	// Get returns the value for key. The bool return value will be
+	// false if the key does not exist.
+	Get(key string) ([]byte, bool, error)
+
+	// Set stores the value for key. The value should be removed after ttl,
+	// a zero ttl means the value does not expire.
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// KeyValueTokenCache is a TokenCache backed by a KeyValueStore. Sharing a store
+// between replicas lets them re-use each other's tokens.
+//
+// Errors from the store are reported to the OnError callback if set, and
+// are otherwise treated as a cache miss.
+type KeyValueTokenCache struct {
+	store  KeyValueStore
+	prefix string
+
+	// OnError is called with errors returned by the store. Optional.
+	OnError func(err error)
+}
+
+// NewKeyValueTokenCache creates a token cache that stores tokens in store. The prefix
+// is added to all keys so a store can be shared with other data.
+func NewKeyValueTokenCache(store KeyValueStore, prefix string) *KeyValueTokenCache {
+	return &KeyValueTokenCache{
+		store:  store,
+		prefix: prefix,
+	}
+}
+
+// Set stores the token with a TTL derived from the token expiry. Tokens that
+// are already expired are not stored.
+func (c *KeyValueTokenCache) Set(key string, token *Token) {
+	var ttl time.Duration
+	if !token.Expiry.IsZero() {
+		ttl = time.Until(token.Expiry.Add(-expiryDelta))
+		if ttl <= 0 {
+			return
+		}
+	}
+
+	data, err := marshalToken(token)
+	if err != nil {
+		c.reportError(err)
+		return
+	}
+
+	if err := c.store.Set(c.prefix+key, data, ttl); err != nil {
+		c.reportError(err)
+	}
+}
+
+// Get retrieves the token associated with the given key from the store. The bool
+// return value will be false if no matching key is found, and true otherwise.
+func (c *KeyValueTokenCache) Get(key string) (*Token, bool) {
+	data, ok, err := c.store.Get(c.prefix + key)
+	if err != nil {
+		c.reportError(err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+
+	token, err := unmarshalToken(data)
+	if err != nil {
+		c.reportError(err)
+		return nil, false
+	}
+
+	if token.Expired() {
+		return nil, false
+	}
+
+	return token, true
+}
+
+func (c *KeyValueTokenCache) reportError(err error) {
+	if c.OnError != nil {
+		c.OnError(err)
+	}
+}
@@ -0,0 +1,96 @@
+package sdk
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRUTokenCache is an in-memory token cache that holds at most a fixed number of
+// tokens. When the cache is full the least recently used token is evicted.
+type LRUTokenCache struct {
+	maxEntries int
+
+	lock      sync.Mutex // guards all fields below
+	entries   map[string]*list.Element
+	order     *list.List
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type lruEntry struct {
+	key   string
+	token *Token
+}
+
+// NewLRUTokenCache creates a new in-memory token cache that holds at most
+// maxEntries tokens. The cache size is unbounded if maxEntries is zero or less.
+func NewLRUTokenCache(maxEntries int) *LRUTokenCache {
+	return &LRUTokenCache{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+	}
+}
+
+// Set adds or updates a token with the given key in the cache.
+func (c *LRUTokenCache) Set(key string, token *Token) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*lruEntry).token = token
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, token: token})
+
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*lruEntry)
+		if !entry.token.Expired() {
+			c.evictions++
+		}
+		c.order.Remove(oldest)
+		delete(c.entries, entry.key)
+	}
+}
+
+// Get retrieves the token associated with the given key from the cache. The bool
+// return value will be false if no matching key is found, and true otherwise.
+func (c *LRUTokenCache) Get(key string) (*Token, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	entry := el.Value.(*lruEntry)
+	if entry.token.Expired() {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		c.misses++
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	c.hits++
+	return entry.token, true
+}
+
+// Stats returns the hit, miss and eviction counters and the current size of the cache.
+func (c *LRUTokenCache) Stats() TokenCacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return TokenCacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Size:      c.order.Len(),
+	}
+}
@@ -1,9 +1,17 @@
 package sdk
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"path"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/openfaas/go-sdk/seal"
 )
 
 func Test_TokenCache(t *testing.T) {
@@ -52,3 +60,215 @@ func Test_TokenCache(t *testing.T) {
 		}
 	})
 }
+
+func Test_MemoryTokenCache_Stats(t *testing.T) {
+	cache := NewMemoryTokenCache()
+
+	cache.Set("valid", &Token{IDToken: "valid", Expiry: time.Now().Add(time.Hour)})
+	cache.Set("expired", &Token{IDToken: "expired", Expiry: time.Now().Add(-time.Hour)})
+
+	cache.Get("valid")
+	cache.Get("valid")
+	cache.Get("expired")
+	cache.Get("missing")
+
+	want := TokenCacheStats{Hits: 2, Misses: 2, Size: 1}
+	if got := cache.Stats(); got != want {
+		t.Errorf("want stats: %+v, got: %+v", want, got)
+	}
+}
+
+func Test_MemoryTokenCache_ConcurrentGC(t *testing.T) {
+	cache := NewMemoryTokenCache()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cache.StartGC(ctx, time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 200; j++ {
+				key := fmt.Sprintf("token%d", j%10)
+				expiry := time.Now().Add(time.Hour)
+				if (i+j)%2 == 0 {
+					expiry = time.Now().Add(-time.Hour)
+				}
+
+				cache.Set(key, &Token{IDToken: key, Expiry: expiry})
+				cache.Get(key)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Expired tokens are removed by the GC, valid tokens are kept.
+	cache.Set("valid", &Token{IDToken: "valid", Expiry: time.Now().Add(time.Hour)})
+	cache.Set("expired", &Token{IDToken: "expired", Expiry: time.Now().Add(-time.Hour)})
+	cache.clearExpired()
+
+	if _, ok := cache.Get("valid"); !ok {
+		t.Errorf("want valid token to be kept")
+	}
+	cache.lock.RLock()
+	_, ok := cache.tokens["expired"]
+	cache.lock.RUnlock()
+	if ok {
+		t.Errorf("want expired token to be removed")
+	}
+}
+
+func Test_MemoryTokenCache_ExpiredGetKeepsReplacement(t *testing.T) {
+	cache := NewMemoryTokenCache()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		cache.Set("fn", &Token{IDToken: "expired", Expiry: time.Now().Add(-time.Hour)})
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cache.Get("fn")
+		}()
+		go func() {
+			defer wg.Done()
+			cache.Set("fn", &Token{IDToken: "valid", Expiry: time.Now().Add(time.Hour)})
+		}()
+		wg.Wait()
+
+		// A fresh token set concurrently with the Get of an expired
+		// token must not be removed from the cache.
+		if got, ok := cache.Get("fn"); !ok || got.IDToken != "valid" {
+			t.Fatalf("want valid token in cache after iteration %d, got: %v", i, got)
+		}
+	}
+}
+
+func Test_LRUTokenCache(t *testing.T) {
+	cache := NewLRUTokenCache(2)
+
+	cache.Set("fn1", &Token{IDToken: "token1"})
+	cache.Set("fn2", &Token{IDToken: "token2"})
+
+	// Use fn1 so fn2 becomes the least recently used token.
+	if _, ok := cache.Get("fn1"); !ok {
+		t.Fatal("want cache hit for fn1")
+	}
+
+	cache.Set("fn3", &Token{IDToken: "token3"})
+
+	if _, ok := cache.Get("fn2"); ok {
+		t.Fatal("want fn2 to be evicted")
+	}
+	if _, ok := cache.Get("fn1"); !ok {
+		t.Fatal("want cache hit for fn1")
+	}
+	if _, ok := cache.Get("fn3"); !ok {
+		t.Fatal("want cache hit for fn3")
+	}
+
+	want := TokenCacheStats{Hits: 3, Misses: 1, Evictions: 1, Size: 2}
+	if got := cache.Stats(); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want stats %+v, got %+v", want, got)
+	}
+}
+
+// memoryKeyValueStore is a KeyValueStore used to test the KeyValueTokenCache.
+type memoryKeyValueStore struct {
+	values map[string][]byte
+	ttls   map[string]time.Duration
+}
+
+func (s *memoryKeyValueStore) Get(key string) ([]byte, bool, error) {
+	v, ok := s.values[key]
+	return v, ok, nil
+}
+
+func (s *memoryKeyValueStore) Set(key string, value []byte, ttl time.Duration) error {
+	s.values[key] = value
+	s.ttls[key] = ttl
+	return nil
+}
+
+func Test_KeyValueTokenCache(t *testing.T) {
+	store := &memoryKeyValueStore{values: map[string][]byte{}, ttls: map[string]time.Duration{}}
+	cache := NewKeyValueTokenCache(store, "openfaas:")
+
+	token := &Token{
+		IDToken: "token1",
+		Expiry:  time.Now().Add(time.Hour).Round(0),
+		Scope:   []string{"function"},
+	}
+	cache.Set("figlet.openfaas-fn", token)
+
+	ttl, ok := store.ttls["openfaas:figlet.openfaas-fn"]
+	if !ok {
+		t.Fatal("want token to be stored with prefixed key")
+	}
+	if ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Fatalf("want ttl derived from expiry, got %s", ttl)
+	}
+
+	got, ok := cache.Get("figlet.openfaas-fn")
+	if !ok {
+		t.Fatal("want cache hit")
+	}
+	if got.IDToken != token.IDToken || !got.Expiry.Equal(token.Expiry) || !reflect.DeepEqual(got.Scope, token.Scope) {
+		t.Fatalf("want token %v, got %v", token, got)
+	}
+
+	cache.Set("expired", &Token{IDToken: "expired", Expiry: time.Now().Add(-time.Minute)})
+	if _, ok := store.values["openfaas:expired"]; ok {
+		t.Fatal("expired tokens should not be stored")
+	}
+}
+
+func Test_FileTokenCache(t *testing.T) {
+	pub, priv, err := seal.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cachePath := path.Join(t.TempDir(), "tokens.sealed")
+
+	cache, err := NewFileTokenCache(cachePath, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := &Token{IDToken: "secret-token", Expiry: time.Now().Add(time.Hour).Round(0)}
+	cache.Set("figlet.openfaas-fn", token)
+
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-token") {
+		t.Fatal("token should be encrypted at rest")
+	}
+
+	// A new cache, i.e. after a restart, loads the persisted tokens.
+	restarted, err := NewFileTokenCache(cachePath, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := restarted.Get("figlet.openfaas-fn")
+	if !ok {
+		t.Fatal("want cache hit after restart")
+	}
+	if got.IDToken != token.IDToken {
+		t.Fatalf("want token %q, got %q", token.IDToken, got.IDToken)
+	}
+
+	_, otherPriv, err := seal.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileTokenCache(cachePath, pub, otherPriv); err == nil {
+		t.Fatal("want error when unsealing with the wrong key")
+	}
+}